@@ -0,0 +1,193 @@
+package monome
+
+import (
+	"image"
+	"image/draw"
+	"image/gif"
+	"io"
+	"sync"
+	"time"
+)
+
+// DefaultFrameDelay is the delay used for GIF frames that don't specify one.
+var DefaultFrameDelay = 100 * time.Millisecond
+
+// Frame is a single frame of an Animation.
+type Frame struct {
+	*LEDBuffer
+	Delay time.Duration // How long the frame is shown for.
+}
+
+// Animation is a sequence of frames.
+type Animation struct {
+	Frames []Frame
+}
+
+// DecodeGIF reads an animated GIF from r and converts each of its frames
+// like FromImage, using the frame delays of the GIF.
+func DecodeGIF(r io.Reader, dither bool) (*Animation, error) {
+	g, err := gif.DecodeAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return FromGIF(g, dither), nil
+}
+
+// FromGIF converts the frames of g like FromImage. Each frame of a GIF may only
+// update part of the image, so frames are composited according to their disposal
+// methods and every frame of the Animation holds the whole image.
+func FromGIF(g *gif.GIF, dither bool) *Animation {
+	bounds := image.Rect(0, 0, g.Config.Width, g.Config.Height)
+	if bounds.Empty() && len(g.Image) > 0 {
+		bounds = g.Image[0].Bounds()
+	}
+	canvas := image.NewRGBA(bounds)
+	a := &Animation{}
+	for i, img := range g.Image {
+		disposal := byte(0)
+		if i < len(g.Disposal) {
+			disposal = g.Disposal[i]
+		}
+		var previous *image.RGBA
+		if disposal == gif.DisposalPrevious {
+			previous = image.NewRGBA(bounds)
+			draw.Draw(previous, bounds, canvas, bounds.Min, draw.Src)
+		}
+		draw.Draw(canvas, img.Bounds(), img, img.Bounds().Min, draw.Over)
+
+		delay := DefaultFrameDelay
+		if i < len(g.Delay) && g.Delay[i] > 0 {
+			delay = time.Duration(g.Delay[i]) * 10 * time.Millisecond
+		}
+		a.Frames = append(a.Frames, Frame{FromImage(canvas, dither), delay})
+
+		switch disposal {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, img.Bounds(), image.Transparent, image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			canvas = previous
+		}
+	}
+	return a
+}
+
+// FromSpriteSheet slices img into width by height frames, left to right and then
+// top to bottom, and converts each of them like FromImage. Every frame is shown for delay.
+// Partial frames at the right and bottom edges of img are skipped.
+func FromSpriteSheet(img image.Image, width, height int, delay time.Duration, dither bool) *Animation {
+	r := img.Bounds()
+	a := &Animation{}
+	for y := r.Min.Y; y+height <= r.Max.Y; y += height {
+		for x := r.Min.X; x+width <= r.Max.X; x += width {
+			b := NewLEDBuffer(width, height)
+			sub := &subImage{img, image.Rect(x, y, x+width, y+height)}
+			b.DrawImage(sub, dither)
+			a.Frames = append(a.Frames, Frame{b, delay})
+		}
+	}
+	return a
+}
+
+// subImage is the part of an image within r.
+type subImage struct {
+	image.Image
+	r image.Rectangle
+}
+
+func (s *subImage) Bounds() image.Rectangle {
+	return s.r
+}
+
+// PlayMode controls what a Player does when it reaches the last frame.
+type PlayMode int
+
+const (
+	// PlayOnce stops on the last frame.
+	PlayOnce PlayMode = iota
+	// PlayLoop starts over from the first frame.
+	PlayLoop
+	// PlayPingPong plays the frames backwards to the first frame and then forwards again.
+	PlayPingPong
+)
+
+// Player plays an Animation on a grid.
+type Player struct {
+	stopOnce sync.Once
+	stop     chan struct{}
+	done     chan struct{}
+	err      error // the render error that ended playback, set by run
+}
+
+// Play starts playing a on w. Each frame is rendered with LEDBuffer.Render,
+// so only the LEDs that change between frames are sent.
+func Play(w LevelWriter, a *Animation, mode PlayMode) *Player {
+	p := &Player{
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	go p.run(w, a, mode)
+	return p
+}
+
+// Done returns a channel that is closed when playback ends,
+// either because a PlayOnce animation has finished or because it was stopped.
+func (p *Player) Done() <-chan struct{} {
+	return p.done
+}
+
+// Stop stops playback, leaving the current frame on the grid.
+// It returns the error that ended playback, if any.
+func (p *Player) Stop() error {
+	p.stopOnce.Do(func() {
+		close(p.stop)
+	})
+	<-p.done
+	return p.err
+}
+
+func (p *Player) run(w LevelWriter, a *Animation, mode PlayMode) {
+	defer close(p.done)
+	if len(a.Frames) == 0 {
+		return
+	}
+	first := a.Frames[0]
+	b := NewLEDBuffer(first.width, first.height)
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		for _, i := range frameOrder(len(a.Frames), mode) {
+			select {
+			case <-timer.C:
+			case <-p.stop:
+				return
+			}
+			f := a.Frames[i]
+			_, err := b.Swap(f.Snapshot())
+			if err == nil {
+				err = b.Render(w)
+			}
+			if err != nil {
+				p.err = err
+				return
+			}
+			timer.Reset(f.Delay)
+		}
+		if mode == PlayOnce {
+			return
+		}
+	}
+}
+
+// frameOrder returns the order of the frames in one cycle of an animation of n frames.
+func frameOrder(n int, mode PlayMode) []int {
+	var order []int
+	for i := 0; i < n; i++ {
+		order = append(order, i)
+	}
+	if mode == PlayPingPong {
+		for i := n - 2; i > 0; i-- {
+			order = append(order, i)
+		}
+	}
+	return order
+}
@@ -0,0 +1,116 @@
+package monome
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDecodeGIF(t *testing.T) {
+	palette := color.Palette{color.Black, color.White, color.Transparent}
+	// The second frame only covers the right half of the image
+	// and is drawn over the first one.
+	first := image.NewPaletted(image.Rect(0, 0, 4, 1), palette)
+	first.Pix = []uint8{1, 0, 0, 0}
+	second := image.NewPaletted(image.Rect(2, 0, 4, 1), palette)
+	second.Pix = []uint8{1, 2}
+	var buf bytes.Buffer
+	err := gif.EncodeAll(&buf, &gif.GIF{
+		Image:  []*image.Paletted{first, second},
+		Delay:  []int{5, 0},
+		Config: image.Config{ColorModel: palette, Width: 4, Height: 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := DecodeGIF(&buf, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(a.Frames) != 2 {
+		t.Fatalf("got %d frames, want 2", len(a.Frames))
+	}
+	want := []Frame{
+		{&LEDBuffer{Buf: []int{15, 0, 0, 0}}, 50 * time.Millisecond},
+		{&LEDBuffer{Buf: []int{15, 0, 15, 0}}, DefaultFrameDelay},
+	}
+	for i, f := range a.Frames {
+		if !reflect.DeepEqual(f.Buf, want[i].Buf) || f.Delay != want[i].Delay {
+			t.Errorf("frame %d: got %v for %v, want %v for %v", i, f.Buf, f.Delay, want[i].Buf, want[i].Delay)
+		}
+	}
+}
+
+func TestFromSpriteSheet(t *testing.T) {
+	sheet := image.NewGray(image.Rect(0, 0, 5, 4))
+	for i := range sheet.Pix {
+		sheet.Pix[i] = uint8(i * 17 % 256)
+	}
+	a := FromSpriteSheet(sheet, 2, 2, time.Second, false)
+	want := [][]int{
+		{0, 1, 5, 6},
+		{2, 3, 7, 8},
+		{10, 11, 15, 1},
+		{12, 13, 2, 3},
+	}
+	if len(a.Frames) != len(want) {
+		t.Fatalf("got %d frames, want %d", len(a.Frames), len(want))
+	}
+	for i, f := range a.Frames {
+		if !reflect.DeepEqual(f.Buf, want[i]) {
+			t.Errorf("frame %d: got %v, want %v", i, f.Buf, want[i])
+		}
+	}
+}
+
+func TestFrameOrder(t *testing.T) {
+	tests := []struct {
+		n    int
+		mode PlayMode
+		want []int
+	}{
+		{3, PlayOnce, []int{0, 1, 2}},
+		{3, PlayLoop, []int{0, 1, 2}},
+		{4, PlayPingPong, []int{0, 1, 2, 3, 2, 1}},
+		{1, PlayPingPong, []int{0}},
+	}
+	for _, test := range tests {
+		if got := frameOrder(test.n, test.mode); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("frameOrder(%d, %d) = %v, want %v", test.n, test.mode, got, test.want)
+		}
+	}
+}
+
+func TestPlay(t *testing.T) {
+	a := &Animation{}
+	for level := 1; level <= 3; level++ {
+		b := NewLEDBuffer(8, 8)
+		b.FillRect(0, 0, 8, 8, level)
+		a.Frames = append(a.Frames, Frame{b, time.Millisecond})
+	}
+
+	dst := NewLEDBuffer(8, 8)
+	p := Play(dst, a, PlayOnce)
+	select {
+	case <-p.Done():
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for the animation to finish")
+	}
+	if err := p.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(dst.Buf, a.Frames[2].Buf) {
+		t.Errorf("got %v, want the last frame", dst.Buf)
+	}
+
+	p = Play(dst, a, PlayPingPong)
+	time.Sleep(10 * time.Millisecond)
+	if err := p.Stop(); err != nil {
+		t.Fatal(err)
+	}
+}
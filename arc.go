@@ -0,0 +1,133 @@
+package monome
+
+import (
+	"github.com/kisielk/go-osc/osc"
+)
+
+// An EncDeltaEvent is received when an encoder on a Monome arc is turned.
+type EncDeltaEvent struct {
+	N     int // The encoder number.
+	Delta int // Positive for clockwise rotation, negative for counter-clockwise.
+}
+
+// An EncKeyEvent is received for every encoder push and release on a Monome arc.
+type EncKeyEvent struct {
+	N     int // The encoder number.
+	State int // 1 for down, 0 for up.
+}
+
+// Arc represents a connection to a Monome arc via SerialOsc.
+type Arc struct {
+	*device
+	deltas     chan EncDeltaEvent
+	keys       chan EncKeyEvent
+	deltaQueue *eventQueue
+	keyQueue   *eventQueue
+}
+
+// DialArc connects to a Monome arc using the given address.
+// The address is obtained from SerialOsc running on the local machine.
+// prefix is the OSC address prefix to be used by the local OSC server.
+// If an empty prefix is given, it defaults to /gopher.
+// Encoder deltas and key presses are sent to the given channels, from queues
+// following the Block policy with DefaultQueueSize events each.
+// Either channel may be nil, such as keys for arcs without push buttons,
+// in which case those events are discarded.
+func DialArc(address, prefix string, deltas chan EncDeltaEvent, keys chan EncKeyEvent) (*Arc, error) {
+	d, err := newDevice(address, prefix)
+	if err != nil {
+		return nil, err
+	}
+	a := &Arc{
+		device:     d,
+		deltas:     deltas,
+		keys:       keys,
+		deltaQueue: newEventQueue(),
+		keyQueue:   newEventQueue(),
+	}
+	a.handlePrefixed("/enc/delta", a.handleDelta)
+	a.handlePrefixed("/enc/key", a.handleKey)
+	err = a.start()
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (a *Arc) handleDelta(msg *osc.Message) {
+	if msg.CountArguments() != 2 {
+		return
+	}
+	n, ok := msg.Arguments[0].(int32)
+	if !ok {
+		return
+	}
+	delta, ok := msg.Arguments[1].(int32)
+	if !ok {
+		return
+	}
+	if a.deltas == nil {
+		return
+	}
+	e := EncDeltaEvent{int(n), int(delta)}
+	a.deltaQueue.push(e.N, func(done <-chan struct{}) {
+		select {
+		case a.deltas <- e:
+		case <-done:
+		}
+	})
+}
+
+func (a *Arc) handleKey(msg *osc.Message) {
+	if msg.CountArguments() != 2 {
+		return
+	}
+	n, ok := msg.Arguments[0].(int32)
+	if !ok {
+		return
+	}
+	state, ok := msg.Arguments[1].(int32)
+	if !ok {
+		return
+	}
+	if a.keys == nil {
+		return
+	}
+	e := EncKeyEvent{int(n), int(state)}
+	a.keyQueue.push(e.N, func(done <-chan struct{}) {
+		select {
+		case a.keys <- e:
+		case <-done:
+		}
+	})
+}
+
+// Close terminates the connection to the arc. Events that have not been read are discarded.
+func (a *Arc) Close() error {
+	a.deltaQueue.close()
+	a.keyQueue.close()
+	return a.device.Close()
+}
+
+// RingSet sets the level of LED x on ring n. The value of level must be in the range [0, 15].
+func (a *Arc) RingSet(n, x, level int) error {
+	return a.send(a.Prefix()+"/ring/set", int32(n), int32(x), int32(level))
+}
+
+// RingAll sets the level of all LEDs on ring n.
+func (a *Arc) RingAll(n, level int) error {
+	return a.send(a.Prefix()+"/ring/all", int32(n), int32(level))
+}
+
+// RingMap sets the levels of all 64 LEDs on ring n.
+func (a *Arc) RingMap(n int, levels [64]int) error {
+	m := osc.NewMessage(a.Prefix()+"/ring/map", int32(n))
+	m.Append(levelsInterfaces(levels[:])...)
+	return a.sendMsg(m)
+}
+
+// RingRange sets the LEDs from x1 to x2 on ring n to the given level.
+// The range wraps around clockwise, so x1 may be greater than x2.
+func (a *Arc) RingRange(n, x1, x2, level int) error {
+	return a.send(a.Prefix()+"/ring/range", int32(n), int32(x1), int32(x2), int32(level))
+}
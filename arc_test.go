@@ -0,0 +1,137 @@
+package monome_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kisielk/monome"
+	"github.com/kisielk/monome/monometest"
+)
+
+// dialArc starts a fake arc with 4 encoders and connects to it directly.
+func dialArc(t *testing.T, deltas chan monome.EncDeltaEvent, keys chan monome.EncKeyEvent) (*monome.Arc, *monometest.Arc) {
+	fa, err := monometest.NewArc("m0000002", 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { fa.Close() })
+	a, err := monome.DialArc(fa.Addr(), "/test", deltas, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { a.Close() })
+	// Wait for the arc to be configured before sending events from it.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	err = a.Refresh(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a, fa
+}
+
+func TestArcEvents(t *testing.T) {
+	deltas := make(chan monome.EncDeltaEvent, 1)
+	keys := make(chan monome.EncKeyEvent, 1)
+	_, fa := dialArc(t, deltas, keys)
+
+	err := fa.Delta(2, -3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case e := <-deltas:
+		if want := (monome.EncDeltaEvent{N: 2, Delta: -3}); e != want {
+			t.Errorf("got %+v, want %+v", e, want)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for delta event")
+	}
+
+	err = fa.Key(1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case e := <-keys:
+		if want := (monome.EncKeyEvent{N: 1, State: 1}); e != want {
+			t.Errorf("got %+v, want %+v", e, want)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for key event")
+	}
+}
+
+func TestArcRings(t *testing.T) {
+	a, fa := dialArc(t, nil, nil)
+
+	var levels [64]int
+	for i := range levels {
+		levels[i] = i % 16
+	}
+	err := a.RingMap(0, levels)
+	if err == nil {
+		err = a.RingAll(1, 5)
+	}
+	if err == nil {
+		err = a.RingSet(1, 10, 15)
+	}
+	if err == nil {
+		err = a.RingRange(2, 62, 1, 9)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = fa.WaitMessages(4, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := fa.Ring(0); got != levels {
+		t.Errorf("ring 0: got %v, want %v", got, levels)
+	}
+	var want [64]int
+	for i := range want {
+		want[i] = 5
+	}
+	want[10] = 15
+	if got := fa.Ring(1); got != want {
+		t.Errorf("ring 1: got %v, want %v", got, want)
+	}
+	// The range wraps around clockwise from 62 to 1.
+	want = [64]int{}
+	want[62], want[63], want[0], want[1] = 9, 9, 9, 9
+	if got := fa.Ring(2); got != want {
+		t.Errorf("ring 2: got %v, want %v", got, want)
+	}
+}
+
+func TestArcUnreadEvents(t *testing.T) {
+	// Nobody reads these channels.
+	a, fa := dialArc(t, make(chan monome.EncDeltaEvent), make(chan monome.EncKeyEvent))
+
+	for i := 0; i < 10; i++ {
+		err := fa.Delta(0, 1)
+		if err == nil {
+			err = fa.Key(0, i%2)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The /sys/* replies are still handled behind the waiting events.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	err := a.SetPrefix(ctx, "/other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = a.Refresh(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fa.Prefix() != "/other" || a.Prefix() != "/other" {
+		t.Errorf("got prefix %q on the device and %q on the arc, want /other", fa.Prefix(), a.Prefix())
+	}
+}
@@ -0,0 +1,462 @@
+package monome
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sync"
+
+	"github.com/kisielk/monome/internal/check"
+)
+
+// LEDBuffer can be used to buffer LED changes to a grid.
+// It supports all the same LED operations as a Grid, but
+// doesn't send anything until buffer.Render() is called.
+//
+// The methods of an LEDBuffer are safe to call from multiple goroutines.
+// Buf may still be used directly, but such access is not synchronized;
+// use Snapshot and Swap to read and replace the whole buffer safely.
+type LEDBuffer struct {
+	Buf    []int
+	width  int
+	height int
+	mu     sync.Mutex // protects Buf
+
+	renderMu sync.Mutex            // serializes rendering, protects sent
+	sent     map[LevelWriter][]int // the levels last rendered to each writer
+}
+
+// Creates a new LEDBuffer with exposed .Buf value for direct
+// manipulation. Requires width and height to calculate size.
+func NewLEDBuffer(width, height int) *LEDBuffer {
+	return &LEDBuffer{
+		Buf:    make([]int, width*height),
+		width:  width,
+		height: height,
+	}
+}
+
+// Width returns the width of the buffer.
+func (b *LEDBuffer) Width() int {
+	return b.width
+}
+
+// Height returns the height of the buffer.
+func (b *LEDBuffer) Height() int {
+	return b.height
+}
+
+// Returns the index of the LEDBuffer given x and y coordinates
+func (b *LEDBuffer) GetIndexFromXY(x, y int) int {
+	index := (y * b.width) + x
+	return index
+}
+
+// Returns the x and y coortinate values given an LEDBuffer index
+func (b *LEDBuffer) GetXYFromIndex(i int) []int {
+	x := int(i % b.width)
+	y := int(math.Floor(float64(i) / float64(b.width)))
+	return []int{x, y}
+}
+
+// Snapshot returns a copy of the levels in the buffer.
+func (b *LEDBuffer) Snapshot() []int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]int(nil), b.Buf...)
+}
+
+// Swap replaces the levels in the buffer with buf and returns the previous levels.
+// buf must hold width*height levels and must not be modified after the call.
+func (b *LEDBuffer) Swap(buf []int) ([]int, error) {
+	if len(buf) != b.width*b.height {
+		return nil, fmt.Errorf("got %d levels, want %d for a %dx%d buffer", len(buf), b.width*b.height, b.width, b.height)
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	old := b.Buf
+	b.Buf = buf
+	return old, nil
+}
+
+// Sets a single led in an LEDBuffer, either on (1) or off (0)
+func (b *LEDBuffer) LEDSet(x, y, state int) error {
+	if err := b.bounds().Point(x, y); err != nil {
+		return err
+	}
+	if err := check.State(state); err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.setLevel(x, y, state*15)
+	return nil
+}
+
+// Sets all leds in an LEDBuffer, either on (1) or off (0)
+func (b *LEDBuffer) LEDAll(state int) error {
+	if err := check.State(state); err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.fill(state * 15)
+	return nil
+}
+
+// Writes an 8x8 quadrant of on/off states to an LEDBuffer like /grid/led/map.
+// states holds a bitmask for each row of the quadrant, from top to bottom,
+// with the least significant bit being the leftmost LED.
+func (b *LEDBuffer) LEDMap(xOffset, yOffset int, states [8]byte) error {
+	if err := b.bounds().Point(xOffset, yOffset); err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for y, s := range states {
+		b.setRowBits(xOffset, yOffset+y, s)
+	}
+	return nil
+}
+
+// Writes a row of on/off states to an LEDBuffer like /grid/led/row.
+// Each byte of states is a bitmask of 8 LEDs along row y, the first byte starting at xOffset,
+// with the least significant bit being the leftmost LED.
+func (b *LEDBuffer) LEDRow(xOffset, y int, states ...byte) error {
+	if err := b.bounds().Bits(xOffset, y, 1, 0, states); err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.setRowBits(xOffset, y, states...)
+	return nil
+}
+
+// Writes a column of on/off states to an LEDBuffer like /grid/led/col.
+// Each byte of states is a bitmask of 8 LEDs down column x, the first byte starting at yOffset,
+// with the least significant bit being the topmost LED.
+func (b *LEDBuffer) LEDCol(x, yOffset int, states ...byte) error {
+	if err := b.bounds().Bits(x, yOffset, 0, 1, states); err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.setColBits(x, yOffset, states...)
+	return nil
+}
+
+// Writes a single led value at x,y with varibright level values 0-15 to an LEDBuffer
+func (b *LEDBuffer) LEDLevelSet(x, y, level int) error {
+	if err := b.bounds().Point(x, y); err != nil {
+		return err
+	}
+	if err := check.Levels(level); err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.setLevel(x, y, level)
+	return nil
+}
+
+// Toggle turns the LED at (x, y) off if it is lit and sets it to level otherwise,
+// as a single step that can't be interleaved with other changes to the buffer.
+func (b *LEDBuffer) Toggle(x, y, level int) error {
+	if err := b.bounds().Point(x, y); err != nil {
+		return err
+	}
+	if err := check.Levels(level); err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.Buf[x+y*b.width] != 0 {
+		level = 0
+	}
+	b.setLevel(x, y, level)
+	return nil
+}
+
+// Writes a single varibright level values 0-15 to an LEDBuffer
+func (b *LEDBuffer) LEDLevelAll(level int) error {
+	if err := check.Levels(level); err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.fill(level)
+	return nil
+}
+
+// Writes an 8x8 quadrant of varibright values to an LEDBuffer, values 0-15.
+// The parts of the quadrant outside of the buffer are ignored.
+func (b *LEDBuffer) LEDLevelMap(xOffset, yOffset int, levels [64]int) error {
+	if err := b.bounds().Point(xOffset, yOffset); err != nil {
+		return err
+	}
+	if err := check.Levels(levels[:]...); err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for y := 0; y < 8; y++ {
+		b.setLevels(xOffset, yOffset+y, 1, 0, levels[y*8:y*8+8])
+	}
+	return nil
+}
+
+// Similar to LEDLevelMap but can map LEDBuffer to arbitrary size of device,
+// levels must hold exactly one value for each LED in the buffer, takes varibright level values 0-15
+func (b *LEDBuffer) LEDLevelMapAll(levels []int) error {
+	if len(levels) != b.width*b.height {
+		return fmt.Errorf("%w: got %d levels for a %dx%d buffer", ErrOutOfBounds, len(levels), b.width, b.height)
+	}
+	if err := check.Levels(levels...); err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	copy(b.Buf, levels)
+	return nil
+}
+
+// Writes a row of data to a LEDBuffer, uses varibright levels 0-15
+func (b *LEDBuffer) LEDLevelRow(xOffset, y int, levels []int) error {
+	if err := b.bounds().Run(xOffset, y, 1, 0, len(levels)); err != nil {
+		return err
+	}
+	if err := check.Levels(levels...); err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.setLevels(xOffset, y, 1, 0, levels)
+	return nil
+}
+
+// Writes a column of data to a LEDBuffer, uses varibright levels 0-15
+func (b *LEDBuffer) LEDLevelCol(x, yOffset int, levels []int) error {
+	if err := b.bounds().Run(x, yOffset, 0, 1, len(levels)); err != nil {
+		return err
+	}
+	if err := check.Levels(levels...); err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.setLevels(x, yOffset, 0, 1, levels)
+	return nil
+}
+
+// Renders a LEDBuffer to w, only sending the LEDs that changed since the last
+// time the buffer was rendered to w. Each changed 8x8 quadrant is sent with a
+// single LEDLevelSet, LEDLevelRow or LEDLevelCol call if the changes allow it,
+// otherwise with LEDLevelMap. The first render to w sends every quadrant.
+// A consistent snapshot of the buffer is rendered even if it is changed concurrently.
+//
+// The buffer remembers what it rendered to each writer until Forget is called
+// or, for a *Grid, until the grid is closed. Writers that are not comparable
+// can't be remembered and are sent every quadrant on every render.
+// If w is changed by other means, use ForceRender to resynchronize it.
+func (b *LEDBuffer) Render(w LevelWriter) error {
+	b.renderMu.Lock()
+	defer b.renderMu.Unlock()
+	snap := b.snapshot()
+	if !rememberable(w) {
+		return b.forceRender(w, snap)
+	}
+	prev, ok := b.sent[w]
+	if !ok || len(prev) != len(snap.Buf) {
+		return b.forceRender(w, snap)
+	}
+	for yOff := 0; yOff < b.height; yOff += 8 {
+		for xOff := 0; xOff < b.width; xOff += 8 {
+			err := snap.renderChanges(w, xOff, yOff, prev)
+			if err != nil {
+				delete(b.sent, w)
+				return err
+			}
+		}
+	}
+	b.remember(w, snap.Buf)
+	return nil
+}
+
+// Forget drops what the buffer remembers about w, so that the next render to w
+// sends every quadrant and w is no longer referenced by the buffer.
+func (b *LEDBuffer) Forget(w LevelWriter) {
+	if !rememberable(w) {
+		return
+	}
+	b.renderMu.Lock()
+	defer b.renderMu.Unlock()
+	delete(b.sent, w)
+}
+
+// ForceRender sends the whole buffer to w using LEDLevelMap, which only requires
+// one osc message per 8x8 quadrant when w is a Grid.
+func (b *LEDBuffer) ForceRender(w LevelWriter) error {
+	b.renderMu.Lock()
+	defer b.renderMu.Unlock()
+	return b.forceRender(w, b.snapshot())
+}
+
+// forceRender sends all of snap to w and records it as sent.
+// It must be called with b.renderMu held.
+func (b *LEDBuffer) forceRender(w LevelWriter, snap *LEDBuffer) error {
+	if rememberable(w) {
+		delete(b.sent, w)
+	}
+	for yOff := 0; yOff < snap.height; yOff += 8 {
+		for xOff := 0; xOff < snap.width; xOff += 8 {
+			err := w.LEDLevelMap(xOff, yOff, snap.levelMap(xOff, yOff))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	b.remember(w, snap.Buf)
+	return nil
+}
+
+// closable is implemented by writers that can be closed, such as *Grid.
+type closable interface {
+	isClosed() bool
+}
+
+// rememberable reports whether w can be used as a key of LEDBuffer.sent.
+func rememberable(w LevelWriter) bool {
+	return reflect.TypeOf(w).Comparable()
+}
+
+// remember records levels as sent to w, and forgets the writers that have been closed.
+// It must be called with b.renderMu held.
+func (b *LEDBuffer) remember(w LevelWriter, levels []int) {
+	for sw := range b.sent {
+		if c, ok := sw.(closable); ok && c.isClosed() {
+			delete(b.sent, sw)
+		}
+	}
+	if !rememberable(w) {
+		return
+	}
+	if b.sent == nil {
+		b.sent = make(map[LevelWriter][]int)
+	}
+	b.sent[w] = levels
+}
+
+// snapshot returns an unshared copy of the buffer.
+func (b *LEDBuffer) snapshot() *LEDBuffer {
+	return &LEDBuffer{
+		Buf:    b.Snapshot(),
+		width:  b.width,
+		height: b.height,
+	}
+}
+
+// renderChanges sends the levels in the quadrant at xOffset, yOffset which differ from prev
+// using the smallest message that covers them.
+func (b *LEDBuffer) renderChanges(w LevelWriter, xOffset, yOffset int, prev []int) error {
+	levels := b.levelMap(xOffset, yOffset)
+	var changed []int
+	for i, level := range levels {
+		x, y := xOffset+i%8, yOffset+i/8
+		if b.inBounds(x, y) && prev[x+y*b.width] != level {
+			changed = append(changed, i)
+		}
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+	first, last := changed[0], changed[len(changed)-1]
+	sameCol := true
+	for _, i := range changed {
+		if i%8 != first%8 {
+			sameCol = false
+		}
+	}
+	switch {
+	case len(changed) == 1:
+		return w.LEDLevelSet(xOffset+first%8, yOffset+first/8, levels[first])
+	case first/8 == last/8:
+		row := first / 8
+		return w.LEDLevelRow(xOffset, yOffset+row, levels[row*8:row*8+min(8, b.width-xOffset)])
+	case sameCol:
+		col := make([]int, min(8, b.height-yOffset))
+		for y := range col {
+			col[y] = levels[first%8+y*8]
+		}
+		return w.LEDLevelCol(xOffset+first%8, yOffset, col)
+	}
+	return w.LEDLevelMap(xOffset, yOffset, levels)
+}
+
+// bounds returns the size of the buffer for checking coordinates. Unlike that of
+// a grid it is always known, so nothing is inside an empty buffer.
+func (b *LEDBuffer) bounds() check.Bounds {
+	return check.Bounds{Width: b.width, Height: b.height}
+}
+
+// setLevel stores level at (x, y), ignoring coordinates outside of the buffer.
+func (b *LEDBuffer) setLevel(x, y, level int) {
+	if x < 0 || y < 0 || x >= b.width || y >= b.height {
+		return
+	}
+	b.Buf[x+y*b.width] = level
+}
+
+// setLevels stores levels starting at (x, y) and advancing by (dx, dy) for each level.
+func (b *LEDBuffer) setLevels(x, y, dx, dy int, levels []int) {
+	for i, level := range levels {
+		b.setLevel(x+i*dx, y+i*dy, level)
+	}
+}
+
+// fill stores level in every position of the buffer.
+func (b *LEDBuffer) fill(level int) {
+	for i := range b.Buf {
+		b.Buf[i] = level
+	}
+}
+
+// setRowBits stores the bitmasks in states along row y starting at xOffset,
+// the least significant bit of each byte being the leftmost LED.
+func (b *LEDBuffer) setRowBits(xOffset, y int, states ...byte) {
+	for i, s := range states {
+		for bit := 0; bit < 8; bit++ {
+			b.setLevel(xOffset+i*8+bit, y, int(s>>uint(bit)&1)*15)
+		}
+	}
+}
+
+// setColBits stores the bitmasks in states along column x starting at yOffset,
+// the least significant bit of each byte being the topmost LED.
+func (b *LEDBuffer) setColBits(x, yOffset int, states ...byte) {
+	for i, s := range states {
+		for bit := 0; bit < 8; bit++ {
+			b.setLevel(x, yOffset+i*8+bit, int(s>>uint(bit)&1)*15)
+		}
+	}
+}
+
+// levelMap returns the levels of the quadrant at xOffset, yOffset,
+// with 0 for the parts of the quadrant outside of the buffer.
+func (b *LEDBuffer) levelMap(xOffset, yOffset int) [64]int {
+	var m [64]int
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			if b.inBounds(x+xOffset, y+yOffset) {
+				m[x+y*8] = b.Buf[x+xOffset+(y+yOffset)*b.width]
+			}
+		}
+	}
+	return m
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,224 @@
+package monome
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestRenderToLevelWriter(t *testing.T) {
+	src := NewLEDBuffer(16, 8)
+	for i := range src.Buf {
+		src.Buf[i] = i % 16
+	}
+	dst := NewLEDBuffer(16, 8)
+	err := src.Render(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(dst.Buf, src.Buf) {
+		t.Errorf("got %v, want %v", dst.Buf, src.Buf)
+	}
+}
+
+func TestLEDBufferConcurrent(t *testing.T) {
+	b := NewLEDBuffer(16, 8)
+	dst := NewLEDBuffer(16, 8)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func(level int) {
+			defer wg.Done()
+			for n := 0; n < 100; n++ {
+				b.LEDLevelSet(n%16, n%8, level)
+				b.Swap(make([]int, 16*8))
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			for n := 0; n < 100; n++ {
+				b.Render(dst)
+				if len(b.Snapshot()) != 16*8 {
+					t.Error("snapshot has the wrong size")
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestLEDBufferSwap(t *testing.T) {
+	b := NewLEDBuffer(8, 8)
+	b.LEDLevelSet(1, 0, 7)
+	levels := make([]int, 64)
+	levels[2] = 3
+	old, err := b.Swap(levels)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if old[1] != 7 {
+		t.Errorf("got previous level %d, want 7", old[1])
+	}
+	if got := b.Snapshot(); !reflect.DeepEqual(got, levels) {
+		t.Errorf("got %v, want %v", got, levels)
+	}
+	if _, err := b.Swap(make([]int, 10)); err == nil {
+		t.Error("Swap with the wrong size did not fail")
+	}
+}
+
+func TestLEDBufferToggle(t *testing.T) {
+	b := NewLEDBuffer(8, 8)
+	var wg sync.WaitGroup
+	// An even number of toggles leaves the LED off, however they interleave.
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				b.Toggle(3, 3, 15)
+			}
+		}()
+	}
+	wg.Wait()
+	if level := b.Snapshot()[3+3*8]; level != 0 {
+		t.Errorf("got level %d after an even number of toggles, want 0", level)
+	}
+	b.Toggle(3, 3, 9)
+	if level := b.Snapshot()[3+3*8]; level != 9 {
+		t.Errorf("got level %d, want 9", level)
+	}
+	if err := b.Toggle(8, 0, 15); !errors.Is(err, ErrOutOfBounds) {
+		t.Errorf("got error %v, want %v", err, ErrOutOfBounds)
+	}
+}
+
+func TestEmptyLEDBuffer(t *testing.T) {
+	// Nothing is inside a buffer with no LEDs, unlike a grid whose size isn't known yet.
+	b := NewLEDBuffer(0, 0)
+	if err := b.LEDLevelSet(3, 3, 1); !errors.Is(err, ErrOutOfBounds) {
+		t.Errorf("LEDLevelSet: got error %v, want %v", err, ErrOutOfBounds)
+	}
+	if err := b.Toggle(0, 0, 15); !errors.Is(err, ErrOutOfBounds) {
+		t.Errorf("Toggle: got error %v, want %v", err, ErrOutOfBounds)
+	}
+}
+
+// TestLEDBufferBitmasks checks the on/off methods against the serialosc protocol:
+// a state of 1 is fully lit, and every byte of a bitmask covers 8 LEDs along its
+// row or column, least significant bit first.
+func TestLEDBufferBitmasks(t *testing.T) {
+	tests := []struct {
+		name          string
+		width, height int
+		f             func(b *LEDBuffer) error
+		want          []string
+	}{
+		{"set", 16, 2, func(b *LEDBuffer) error { return b.LEDSet(9, 1, 1) }, []string{
+			"................",
+			".........f......",
+		}},
+		{"all", 16, 2, func(b *LEDBuffer) error { return b.LEDAll(1) }, []string{
+			"ffffffffffffffff",
+			"ffffffffffffffff",
+		}},
+		{"all tall", 2, 16, func(b *LEDBuffer) error { return b.LEDAll(1) }, []string{
+			"ff", "ff", "ff", "ff", "ff", "ff", "ff", "ff",
+			"ff", "ff", "ff", "ff", "ff", "ff", "ff", "ff",
+		}},
+		{"row", 16, 2, func(b *LEDBuffer) error { return b.LEDRow(0, 1, 0x01, 0x80) }, []string{
+			"................",
+			"f..............f",
+		}},
+		{"row second quadrant", 16, 2, func(b *LEDBuffer) error { return b.LEDRow(8, 0, 0x35) }, []string{
+			"........f.f.ff..",
+			"................",
+		}},
+		{"col", 2, 16, func(b *LEDBuffer) error { return b.LEDCol(1, 0, 0x03, 0xc0) }, []string{
+			".f", ".f", "..", "..", "..", "..", "..", "..",
+			"..", "..", "..", "..", "..", "..", ".f", ".f",
+		}},
+		{"map", 16, 8, func(b *LEDBuffer) error {
+			return b.LEDMap(8, 0, [8]byte{0x01, 0x02, 0x04, 0x08, 0x10, 0x20, 0x40, 0x80})
+		}, []string{
+			"........f.......",
+			".........f......",
+			"..........f.....",
+			"...........f....",
+			"............f...",
+			".............f..",
+			"..............f.",
+			"...............f",
+		}},
+		{"row narrow", 4, 1, func(b *LEDBuffer) error { return b.LEDRow(0, 0, 0xf9) }, []string{
+			"f..f",
+		}},
+	}
+	for _, test := range tests {
+		b := NewLEDBuffer(test.width, test.height)
+		err := test.f(b)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if got := picture(b); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+// closingWriter is a writer that can be closed, like a Grid.
+type closingWriter struct {
+	*LEDBuffer
+	closed bool
+}
+
+func (w *closingWriter) isClosed() bool {
+	return w.closed
+}
+
+// levelLog is a writer that isn't comparable.
+type levelLog struct {
+	*LEDBuffer
+	log []int
+}
+
+func TestRenderForget(t *testing.T) {
+	b := NewLEDBuffer(8, 8)
+	b.LEDLevelSet(1, 1, 5)
+
+	w := &countingWriter{LEDBuffer: NewLEDBuffer(8, 8)}
+	for i := 0; i < 2; i++ {
+		err := b.Render(w)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if w.calls != 1 {
+		t.Errorf("got %d calls before Forget, want 1", w.calls)
+	}
+	b.Forget(w)
+	err := b.Render(w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.calls != 2 {
+		t.Errorf("got %d calls after Forget, want 2", w.calls)
+	}
+
+	c := &closingWriter{LEDBuffer: NewLEDBuffer(8, 8)}
+	err = b.Render(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.closed = true
+	// Writers that aren't comparable are rendered in full and not remembered.
+	err = b.Render(levelLog{LEDBuffer: NewLEDBuffer(8, 8)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := b.sent[c]; ok || len(b.sent) != 1 {
+		t.Errorf("got %d remembered writers including the closed one: %v, want only the first writer", len(b.sent), ok)
+	}
+}
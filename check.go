@@ -0,0 +1,11 @@
+package monome
+
+import "github.com/kisielk/monome/internal/check"
+
+var (
+	// ErrOutOfBounds is returned by LED methods given coordinates outside of the grid or buffer.
+	ErrOutOfBounds = check.ErrOutOfBounds
+	// ErrInvalidLevel is returned by LED methods given a level outside of [0, 15]
+	// or a state other than 0 or 1.
+	ErrInvalidLevel = check.ErrInvalidLevel
+)
@@ -0,0 +1,84 @@
+package monome_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/kisielk/monome"
+)
+
+// TestProtocolConformance checks the OSC address and arguments sent by every
+// Grid LED method against the serialosc protocol.
+func TestProtocolConformance(t *testing.T) {
+	s, fg := newFakes(t)
+	g := connect(t, s, make(chan monome.KeyEvent))
+
+	var levels [64]int
+	for i := range levels {
+		levels[i] = i % 16
+	}
+	levelArgs := make([]interface{}, 64)
+	for i := range levelArgs {
+		levelArgs[i] = int32(i % 16)
+	}
+
+	tests := []struct {
+		name    string
+		f       func() error
+		address string
+		args    []interface{}
+	}{
+		{"LEDSet", func() error { return g.LEDSet(3, 4, 1) },
+			"/test/grid/led/set", []interface{}{int32(3), int32(4), int32(1)}},
+		{"LEDAll", func() error { return g.LEDAll(0) },
+			"/test/grid/led/all", []interface{}{int32(0)}},
+		{"LEDMap", func() error { return g.LEDMap(8, 0, [8]byte{1, 2, 3, 4, 5, 6, 7, 255}) },
+			"/test/grid/led/map", []interface{}{int32(8), int32(0),
+				int32(1), int32(2), int32(3), int32(4), int32(5), int32(6), int32(7), int32(255)}},
+		{"LEDRow", func() error { return g.LEDRow(0, 5, 0x0f, 0xf0) },
+			"/test/grid/led/row", []interface{}{int32(0), int32(5), int32(0x0f), int32(0xf0)}},
+		{"LEDCol", func() error { return g.LEDCol(6, 0, 0xaa) },
+			"/test/grid/led/col", []interface{}{int32(6), int32(0), int32(0xaa)}},
+		{"LEDIntensity", func() error { return g.LEDIntensity(12) },
+			"/test/grid/led/intensity", []interface{}{int32(12)}},
+		{"LEDLevelSet", func() error { return g.LEDLevelSet(15, 7, 9) },
+			"/test/grid/led/level/set", []interface{}{int32(15), int32(7), int32(9)}},
+		{"LEDLevelAll", func() error { return g.LEDLevelAll(4) },
+			"/test/grid/led/level/all", []interface{}{int32(4)}},
+		{"LEDLevelMap", func() error { return g.LEDLevelMap(8, 0, levels) },
+			"/test/grid/led/level/map", append([]interface{}{int32(8), int32(0)}, levelArgs...)},
+		{"LEDLevelRow", func() error { return g.LEDLevelRow(0, 2, levels[:16]) },
+			"/test/grid/led/level/row", append([]interface{}{int32(0), int32(2)}, levelArgs[:16]...)},
+		{"LEDLevelCol", func() error { return g.LEDLevelCol(1, 0, levels[:8]) },
+			"/test/grid/led/level/col", append([]interface{}{int32(1), int32(0)}, levelArgs[:8]...)},
+	}
+	for i, test := range tests {
+		err := test.f()
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		err = fg.WaitMessages(i+1, time.Second)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		m := fg.Messages()[i]
+		if m.Address != test.address {
+			t.Errorf("%s: sent %s, want %s", test.name, m.Address, test.address)
+		}
+		if !reflect.DeepEqual(m.Arguments, test.args) {
+			t.Errorf("%s: sent arguments %v, want %v", test.name, m.Arguments, test.args)
+		}
+	}
+
+	// The column ends up where the device puts it.
+	g.LEDAll(0)
+	g.LEDCol(6, 0, 0xaa)
+	err := fg.WaitMessages(len(tests)+2, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fg.Level(6, 1) != 15 || fg.Level(6, 0) != 0 || fg.Level(7, 1) != 0 {
+		t.Errorf("LEDCol lit the wrong LEDs")
+	}
+}
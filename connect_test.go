@@ -0,0 +1,787 @@
+package monome_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/kisielk/monome"
+	"github.com/kisielk/monome/monometest"
+)
+
+// newFakes starts a fake serialosc with a single fake 16x8 grid added to it.
+func newFakes(t *testing.T) (*monometest.SerialOsc, *monometest.Grid) {
+	s, err := monometest.NewSerialOsc()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	fg, err := monometest.NewGrid("m0000001", 16, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { fg.Close() })
+	s.Add(fg)
+	return s, fg
+}
+
+// nextEvent returns the next event from a DeviceManager, failing the test if none arrives within a second.
+func nextEvent(t *testing.T, events <-chan monome.ManagerEvent) monome.ManagerEvent {
+	t.Helper()
+	select {
+	case ev := <-events:
+		return ev
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for manager event")
+		return nil
+	}
+}
+
+// waitFor polls cond until it is true, failing the test if that takes more than a second.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// connect connects to the first grid known to s.
+func connect(t *testing.T, s *monometest.SerialOsc, keys chan monome.KeyEvent) *monome.Grid {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	g, err := monome.ConnectAddress(ctx, s.Addr(), "/test", keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { g.Close() })
+	return g
+}
+
+func TestConnect(t *testing.T) {
+	s, fg := newFakes(t)
+	g := connect(t, s, make(chan monome.KeyEvent))
+	if g.Id() != fg.Id() || g.Width() != 16 || g.Height() != 8 || g.Prefix() != "/test" {
+		t.Errorf("got id %q, size %dx%d, prefix %q", g.Id(), g.Width(), g.Height(), g.Prefix())
+	}
+	if fg.Prefix() != "/test" {
+		t.Errorf("device prefix is %q, want /test", fg.Prefix())
+	}
+}
+
+func TestRender(t *testing.T) {
+	s, fg := newFakes(t)
+	g := connect(t, s, make(chan monome.KeyEvent))
+
+	b := monome.NewLEDBuffer(g.Width(), g.Height())
+	for i := range b.Buf {
+		b.Buf[i] = i % 16
+	}
+	err := b.Render(g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = fg.WaitMessages(2, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fg.Frame(); !reflect.DeepEqual(got, b.Buf) {
+		t.Errorf("got frame %v, want %v", got, b.Buf)
+	}
+}
+
+func TestKeys(t *testing.T) {
+	s, fg := newFakes(t)
+	keys := make(chan monome.KeyEvent)
+	connect(t, s, keys)
+
+	var last time.Time
+	for i, want := range []monome.KeyEvent{{X: 3, Y: 4, State: 1}, {X: 3, Y: 4, State: 0}} {
+		want.Seq = uint64(i + 1)
+		want.Device = fg.Id()
+		err := fg.Key(want.X, want.Y, want.State)
+		if err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case e := <-keys:
+			if e.Time.IsZero() || e.Time.Before(last) {
+				t.Errorf("got time %v after %v", e.Time, last)
+			}
+			last = e.Time
+			e.Time = time.Time{}
+			if e != want {
+				t.Errorf("got %+v, want %+v", e, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for key event")
+		}
+	}
+}
+
+// dial connects to fg directly and waits for its replies.
+func dial(t *testing.T, fg *monometest.Grid, keys chan monome.KeyEvent) *monome.Grid {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	g, err := monome.DialGridContext(ctx, fg.Addr(), "/test", keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { g.Close() })
+	return g
+}
+
+func TestGridTilt(t *testing.T) {
+	_, fg := newFakes(t)
+	g := dial(t, fg, make(chan monome.KeyEvent))
+
+	err := g.TiltSet(1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for !fg.TiltEnabled(1) && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if !fg.TiltEnabled(1) {
+		t.Error("tilt sensor 1 was not enabled")
+	}
+
+	tilt := make(chan monome.TiltEvent, 1)
+	g.SetTiltEvents(tilt)
+	err = fg.Tilt(1, 10, -20, 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case e := <-tilt:
+		if want := (monome.TiltEvent{N: 1, X: 10, Y: -20, Z: 30}); e != want {
+			t.Errorf("got %+v, want %+v", e, want)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for tilt event")
+	}
+}
+
+func TestGridTiltDisabled(t *testing.T) {
+	_, fg := newFakes(t)
+	keys := make(chan monome.KeyEvent, 1)
+	dial(t, fg, keys)
+
+	// Tilt data without a tilt channel must not block or reach the key channel.
+	err := fg.Tilt(0, 1, 2, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = fg.Key(1, 2, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case e := <-keys:
+		if e.X != 1 || e.Y != 2 || e.State != 1 || e.Seq != 1 {
+			t.Errorf("got %+v, want the first key event, a press of (1, 2)", e)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for key event")
+	}
+}
+
+func TestDialGridContext(t *testing.T) {
+	_, fg := newFakes(t)
+	g := dial(t, fg, make(chan monome.KeyEvent))
+	if g.Id() != fg.Id() || g.Width() != 16 || g.Height() != 8 || g.Rotation() != 0 {
+		t.Errorf("got id %q, size %dx%d, rotation %d", g.Id(), g.Width(), g.Height(), g.Rotation())
+	}
+}
+
+func TestDialGridContextMissingInfo(t *testing.T) {
+	_, fg := newFakes(t)
+	fg.Withhold("/sys/size", "/sys/rotation")
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err := monome.DialGridContext(ctx, fg.Addr(), "/test", make(chan monome.KeyEvent))
+	var infoErr *monome.InfoError
+	if !errors.As(err, &infoErr) {
+		t.Fatalf("got error %v, want *InfoError", err)
+	}
+	if !reflect.DeepEqual(infoErr.Missing, []string{"/sys/size", "/sys/rotation"}) {
+		t.Errorf("got missing %v", infoErr.Missing)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got error %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestDeviceManager(t *testing.T) {
+	s, fg := newFakes(t)
+	events := make(chan monome.ManagerEvent)
+	m, err := monome.NewDeviceManager(s.Addr(), "/test", make(chan monome.KeyEvent), events)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	// The grid known to serialosc when the manager starts.
+	if ev, ok := nextEvent(t, events).(monome.AttachEvent); !ok || ev.Grid.Id() != fg.Id() || ev.Grid.Width() != 16 {
+		t.Fatalf("got %+v, want attach of %s", ev, fg.Id())
+	}
+
+	// A grid plugged in later.
+	fg2, err := monometest.NewGrid("m0000002", 8, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fg2.Close()
+	s.Add(fg2)
+	if ev, ok := nextEvent(t, events).(monome.AttachEvent); !ok || ev.Device.Id != fg2.Id() {
+		t.Fatalf("got %+v, want attach of %s", ev, fg2.Id())
+	}
+	if len(m.Grids()) != 2 {
+		t.Errorf("got %d grids, want 2", len(m.Grids()))
+	}
+
+	// Notifications must keep coming after the first one.
+	s.Remove(fg)
+	if ev, ok := nextEvent(t, events).(monome.DetachEvent); !ok || ev.Device.Id != fg.Id() {
+		t.Fatalf("got %+v, want detach of %s", ev, fg.Id())
+	}
+	if m.Grid(fg.Id()) != nil {
+		t.Errorf("grid %s still registered after detach", fg.Id())
+	}
+}
+
+// unreachable is a device that serialosc reports on a port that can't be sent to.
+type unreachable struct{}
+
+func (unreachable) Id() string   { return "m0000009" }
+func (unreachable) Type() string { return "monome 64" }
+func (unreachable) Port() int    { return -1 }
+
+func TestDeviceManagerDialErrors(t *testing.T) {
+	s, fg := newFakes(t)
+	events := make(chan monome.ManagerEvent)
+	m, err := monome.NewDeviceManager(s.Addr(), "/test", make(chan monome.KeyEvent), events)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	if ev, ok := nextEvent(t, events).(monome.AttachEvent); !ok || ev.Device.Id != fg.Id() {
+		t.Fatalf("got %+v, want attach of %s", ev, fg.Id())
+	}
+
+	// A grid that can't be opened is reported.
+	s.Add(unreachable{})
+	if ev, ok := nextEvent(t, events).(monome.ErrorEvent); !ok || ev.Device.Id != "m0000009" || ev.Err == nil {
+		t.Fatalf("got %+v, want error for m0000009", ev)
+	}
+
+	// A grid that never replies doesn't hold up the other devices.
+	silent, err := monometest.NewGrid("m0000003", 8, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	silent.Close()
+	s.Add(silent)
+	s.Remove(fg)
+	if ev, ok := nextEvent(t, events).(monome.DetachEvent); !ok || ev.Device.Id != fg.Id() {
+		t.Fatalf("got %+v, want detach of %s", ev, fg.Id())
+	}
+
+	// Closing the manager gives up on the grid still being opened.
+	closed := make(chan struct{})
+	go func() {
+		m.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("timed out closing the manager while a grid is being opened")
+	}
+}
+
+func TestReconnect(t *testing.T) {
+	s, fg := newFakes(t)
+	g := connect(t, s, make(chan monome.KeyEvent))
+	// LEDs set before reconnection is enabled are restored as well.
+	g.LEDLevelSet(0, 1, 7)
+	err := g.EnableReconnect(s.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	g.LEDLevelSet(1, 1, 10)
+	err = fg.WaitMessages(2, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A key held when the device is unplugged must not stay down.
+	handled := make(chan monome.KeyEvent, 1)
+	g.HandleKey(func(e monome.KeyEvent) { handled <- e })
+	g.SetOverflowPolicy(monome.DropNewest, 1)
+	err = fg.Key(3, 3, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-handled:
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for key handler")
+	}
+	if !g.Keys().IsDown(3, 3) {
+		t.Error("key (3, 3) is not down after being pressed")
+	}
+
+	s.Remove(fg)
+	fg.Close()
+	// The held key is released once the grid notices the device is gone.
+	deadline := time.Now().Add(time.Second)
+	for len(g.Keys().DownKeys()) != 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if keys := g.Keys().DownKeys(); len(keys) != 0 {
+		t.Errorf("keys %+v still down after the device was removed", keys)
+	}
+	g.LEDLevelSet(2, 2, 5)
+
+	// The same device comes back on a different port.
+	fg2, err := monometest.NewGrid(fg.Id(), 16, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fg2.Close()
+	s.Add(fg2)
+	err = fg2.WaitMessages(2, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fg2.Prefix() != "/test" {
+		t.Errorf("device prefix is %q, want /test", fg2.Prefix())
+	}
+	if fg2.Level(0, 1) != 7 || fg2.Level(1, 1) != 10 || fg2.Level(2, 2) != 5 {
+		t.Errorf("got levels %d, %d and %d after reconnect, want 7, 10 and 5", fg2.Level(0, 1), fg2.Level(1, 1), fg2.Level(2, 2))
+	}
+}
+
+func TestReconnectBeforeSize(t *testing.T) {
+	s, fg := newFakes(t)
+	// The size of the first device never arrives, so it is unknown when
+	// reconnection is enabled.
+	fg.Withhold("/sys/size")
+	g, err := monome.DialGrid(fg.Addr(), "/test", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+	err = g.EnableReconnect(s.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// replug replaces the device with a new one with the same id and waits for
+	// the grid to know its size.
+	replug := func(old *monometest.Grid) *monometest.Grid {
+		// A key held on the old device is released once the grid notices it is gone,
+		// after which serialosc is watched for the new one.
+		waitFor(t, "the grid to configure the device", func() bool { return old.Prefix() == "/test" })
+		err := old.Key(0, 0, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		waitFor(t, "the key press", func() bool { return g.Keys().IsDown(0, 0) })
+		s.Remove(old)
+		old.Close()
+		waitFor(t, "the device to be removed", func() bool { return !g.Keys().IsDown(0, 0) })
+
+		fg, err := monometest.NewGrid(old.Id(), 16, 8)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { fg.Close() })
+		s.Add(fg)
+		waitFor(t, "the size of the grid", func() bool { return g.Width() != 0 })
+		return fg
+	}
+	fg2 := replug(fg)
+	err = g.LEDLevelSet(1, 1, 9)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = fg2.WaitMessages(1, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The LED set once the size was known is restored on the next device.
+	fg3 := replug(fg2)
+	err = fg3.WaitMessages(2, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fg3.Level(1, 1) != 9 {
+		t.Errorf("got level %d after reconnect, want 9", fg3.Level(1, 1))
+	}
+}
+
+func TestReconnectRotated(t *testing.T) {
+	s, fg := newFakes(t)
+	g := connect(t, s, make(chan monome.KeyEvent))
+	err := g.EnableReconnect(s.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	reconnected := make(chan error, 1)
+	g.HandleReconnect(func(err error) { reconnected <- err })
+	g.LEDLevelSet(0, 0, 5)
+
+	// Rotating the 16x8 grid by 90 degrees makes it 8x16, and the LED at the top left
+	// of the device is now at the top right.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	err = g.SetRotation(ctx, 90)
+	if err == nil {
+		err = g.Refresh(ctx)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = g.LEDLevelSet(7, 15, 9)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = fg.WaitMessages(2, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Hold a key so that the removal can be seen, see TestReconnect.
+	err = fg.Key(0, 0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the key press", func() bool { return g.Keys().IsDown(0, 0) })
+	s.Remove(fg)
+	fg.Close()
+	waitFor(t, "the device to be removed", func() bool { return !g.Keys().IsDown(0, 0) })
+
+	fg2, err := monometest.NewGrid(fg.Id(), 16, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fg2.Close()
+	s.Add(fg2)
+	select {
+	case err := <-reconnected:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for the grid to reconnect")
+	}
+	err = fg2.WaitMessages(2, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fg2.Rotation() != 90 {
+		t.Errorf("got rotation %d on the new device, want 90", fg2.Rotation())
+	}
+	// Both LEDs are where they were on the device.
+	if fg2.Level(0, 0) != 5 || fg2.Level(15, 0) != 9 {
+		t.Errorf("got levels %d and %d after reconnect, want 5 and 9", fg2.Level(0, 0), fg2.Level(15, 0))
+	}
+}
+
+func TestRenderChanges(t *testing.T) {
+	s, fg := newFakes(t)
+	g := connect(t, s, make(chan monome.KeyEvent))
+	b := monome.NewLEDBuffer(g.Width(), g.Height())
+
+	tests := []struct {
+		name string
+		draw func()
+		want []string
+	}{
+		{"first", func() {}, []string{"/test/grid/led/level/map", "/test/grid/led/level/map"}},
+		{"unchanged", func() {}, nil},
+		{"single", func() { b.Buf[9] = 5 }, []string{"/test/grid/led/level/set"}},
+		{"row", func() { b.Buf[16] = 1; b.Buf[20] = 2 }, []string{"/test/grid/led/level/row"}},
+		{"col", func() { b.Buf[10] = 3; b.Buf[10+16*7] = 3 }, []string{"/test/grid/led/level/col"}},
+		{"quadrants", func() { b.Buf[0] = 1; b.Buf[17] = 1; b.Buf[8] = 1 },
+			[]string{"/test/grid/led/level/map", "/test/grid/led/level/set"}},
+	}
+	sent := 0
+	for _, test := range tests {
+		test.draw()
+		err := b.Render(g)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sent += len(test.want)
+		err = fg.WaitMessages(sent, time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		msgs := fg.Messages()
+		var got []string
+		for _, m := range msgs[sent-len(test.want):] {
+			got = append(got, m.Address)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: sent %v, want %v", test.name, got, test.want)
+		}
+		if !reflect.DeepEqual(fg.Frame(), b.Buf) {
+			t.Errorf("%s: got frame %v, want %v", test.name, fg.Frame(), b.Buf)
+		}
+	}
+
+	// ForceRender resends everything even though nothing changed.
+	err := b.ForceRender(g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = fg.WaitMessages(sent+2, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLEDErrors(t *testing.T) {
+	s, fg := newFakes(t)
+	g := connect(t, s, make(chan monome.KeyEvent))
+	b := monome.NewLEDBuffer(16, 8)
+
+	type writer interface {
+		monome.LEDWriter
+		monome.LevelWriter
+	}
+	tests := []struct {
+		name string
+		f    func(w writer) error
+		want error
+	}{
+		{"LEDSet x", func(w writer) error { return w.LEDSet(16, 0, 1) }, monome.ErrOutOfBounds},
+		{"LEDSet y", func(w writer) error { return w.LEDSet(0, -1, 1) }, monome.ErrOutOfBounds},
+		{"LEDSet state", func(w writer) error { return w.LEDSet(0, 0, 15) }, monome.ErrInvalidLevel},
+		{"LEDAll", func(w writer) error { return w.LEDAll(2) }, monome.ErrInvalidLevel},
+		{"LEDMap", func(w writer) error { return w.LEDMap(16, 0, [8]byte{}) }, monome.ErrOutOfBounds},
+		{"LEDRow", func(w writer) error { return w.LEDRow(8, 0, 0xff, 0xff) }, monome.ErrOutOfBounds},
+		{"LEDCol", func(w writer) error { return w.LEDCol(0, 0, 0xff, 0xff) }, monome.ErrOutOfBounds},
+		{"LEDLevelSet", func(w writer) error { return w.LEDLevelSet(1, 1, 16) }, monome.ErrInvalidLevel},
+		{"LEDLevelAll", func(w writer) error { return w.LEDLevelAll(-1) }, monome.ErrInvalidLevel},
+		{"LEDLevelMap", func(w writer) error { return w.LEDLevelMap(0, 8, [64]int{}) }, monome.ErrOutOfBounds},
+		{"LEDLevelMap level", func(w writer) error { return w.LEDLevelMap(0, 0, [64]int{63: 20}) }, monome.ErrInvalidLevel},
+		{"LEDLevelRow", func(w writer) error { return w.LEDLevelRow(10, 0, make([]int, 8)) }, monome.ErrOutOfBounds},
+		{"LEDLevelCol", func(w writer) error { return w.LEDLevelCol(0, 1, make([]int, 8)) }, monome.ErrOutOfBounds},
+	}
+	for _, test := range tests {
+		for _, w := range []writer{g, b} {
+			if err := test.f(w); !errors.Is(err, test.want) {
+				t.Errorf("%s on %T: got error %v, want %v", test.name, w, err, test.want)
+			}
+		}
+	}
+	if err := g.LEDIntensity(16); !errors.Is(err, monome.ErrInvalidLevel) {
+		t.Errorf("LEDIntensity: got error %v, want %v", err, monome.ErrInvalidLevel)
+	}
+
+	for _, level := range b.Buf {
+		if level != 0 {
+			t.Fatalf("buffer changed by failed calls: %v", b.Buf)
+		}
+	}
+	// Nothing was sent for the failed calls, so this is the first message.
+	err := g.LEDLevelSet(15, 7, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = fg.WaitMessages(1, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msgs := fg.Messages(); msgs[0].Address != "/test/grid/led/level/set" {
+		t.Errorf("got %s as the first message", msgs[0].Address)
+	}
+}
+
+func TestRotated(t *testing.T) {
+	s, fg := newFakes(t)
+	g := connect(t, s, make(chan monome.KeyEvent))
+
+	// The 16x8 grid is mounted turned clockwise, so its left edge is at the top.
+	r, err := monome.NewRotated(g, 90)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Width() != 8 || r.Height() != 16 {
+		t.Fatalf("got size %dx%d, want 8x16", r.Width(), r.Height())
+	}
+	err = r.LEDLevelSet(0, 0, 15)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = r.LEDLevelRow(0, 15, []int{1, 2, 3, 4, 5, 6, 7, 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = fg.WaitMessages(3, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fg.Level(0, 7) != 15 || fg.Level(15, 7) != 1 || fg.Level(15, 0) != 8 {
+		t.Errorf("got levels %d, %d and %d, want 15, 1 and 8", fg.Level(0, 7), fg.Level(15, 7), fg.Level(15, 0))
+	}
+	if err := r.LEDLevelSet(8, 0, 1); !errors.Is(err, monome.ErrOutOfBounds) {
+		t.Errorf("got error %v, want %v", err, monome.ErrOutOfBounds)
+	}
+
+	e := r.Key(monome.KeyEvent{X: 0, Y: 7, State: 1})
+	if want := (monome.KeyEvent{X: 0, Y: 0, State: 1}); e != want {
+		t.Errorf("got %+v, want %+v", e, want)
+	}
+	e = r.Key(monome.KeyEvent{X: 15, Y: 0})
+	if want := (monome.KeyEvent{X: 7, Y: 15}); e != want {
+		t.Errorf("got %+v, want %+v", e, want)
+	}
+
+}
+
+func TestRotatedFollowsSize(t *testing.T) {
+	s, fg := newFakes(t)
+	g := connect(t, s, make(chan monome.KeyEvent))
+	r, err := monome.NewRotated(g, 90)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = r.LEDLevelSet(0, 0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Rotating the 16x8 grid by 90 degrees in serialosc makes it 8x16,
+	// so as mounted it is upside down and 16x8.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	err = g.SetRotation(ctx, 90)
+	if err == nil {
+		err = g.Refresh(ctx)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.Width() != 8 || g.Height() != 16 {
+		t.Fatalf("got grid size %dx%d, want 8x16", g.Width(), g.Height())
+	}
+	if r.Width() != 16 || r.Height() != 8 {
+		t.Fatalf("got size %dx%d, want 16x8", r.Width(), r.Height())
+	}
+	err = r.LEDLevelSet(15, 7, 9)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The whole of the new size is sent, as two 8x8 maps.
+	err = fg.WaitMessages(3, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fg.Level(0, 0) != 9 {
+		t.Errorf("got level %d at the top left of the device, want 9", fg.Level(0, 0))
+	}
+	if e := r.Key(monome.KeyEvent{X: 7, Y: 0}); e.X != 15 || e.Y != 7 {
+		t.Errorf("got key (%d, %d), want (15, 7)", e.X, e.Y)
+	}
+}
+
+func TestSysSettings(t *testing.T) {
+	s, fg := newFakes(t)
+	keys := make(chan monome.KeyEvent, 1)
+	g := connect(t, s, keys)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	err := g.SetRotation(ctx, 180)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fg.Rotation() != 180 || g.Rotation() != 180 {
+		t.Errorf("got rotation %d on the device and %d on the grid, want 180", fg.Rotation(), g.Rotation())
+	}
+	if err := g.SetRotation(ctx, 45); err == nil {
+		t.Error("SetRotation(45) did not fail")
+	}
+
+	err = g.SetPrefix(ctx, "/other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fg.Prefix() != "/other" || g.Prefix() != "/other" {
+		t.Errorf("got prefix %q on the device and %q on the grid, want /other", fg.Prefix(), g.Prefix())
+	}
+	// Keys are still delivered with the new prefix.
+	err = fg.Key(1, 2, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case e := <-keys:
+		if e.X != 1 || e.Y != 2 || e.State != 1 {
+			t.Errorf("got %+v, want a press of (1, 2)", e)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for key event after changing the prefix")
+	}
+	// And LEDs are sent with it.
+	err = g.LEDLevelSet(0, 0, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = fg.WaitMessages(1, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = g.Refresh(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestKeyHandlerAndOverflow(t *testing.T) {
+	s, fg := newFakes(t)
+	// Nobody reads this channel.
+	g := connect(t, s, make(chan monome.KeyEvent))
+	g.SetOverflowPolicy(monome.DropNewest, 1)
+	handled := make(chan monome.KeyEvent, 10)
+	g.HandleKey(func(e monome.KeyEvent) { handled <- e })
+
+	for i := 0; i < 5; i++ {
+		err := fg.Key(i, 0, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 5; i++ {
+		select {
+		case e := <-handled:
+			if e.X != i {
+				t.Errorf("got key %+v, want x %d", e, i)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for key handler")
+		}
+	}
+
+	// Replies from the device are still handled.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	err := g.Refresh(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,302 @@
+package monome
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/kisielk/go-osc/osc"
+)
+
+// device holds the OSC connection and the /sys/* state shared by all
+// serialosc devices.
+type device struct {
+	*oscConnection
+	mu       sync.RWMutex
+	id       string
+	width    int
+	height   int
+	prefix   string
+	rotation int
+
+	// prefixed holds the handlers for device messages, by address without the prefix.
+	// They are registered again whenever the device reports a new prefix.
+	prefixed map[string]osc.HandlerFunc
+
+	// seen records the /sys/* replies received so far.
+	// updated is closed and replaced whenever a reply is received.
+	seen    sysField
+	updated chan struct{}
+}
+
+// sysField identifies a /sys/* reply from a device.
+type sysField uint
+
+const (
+	sysId sysField = 1 << iota
+	sysSize
+	sysPrefix
+	sysRotation
+)
+
+var sysFieldAddresses = []string{"/sys/id", "/sys/size", "/sys/prefix", "/sys/rotation"}
+
+// addresses returns the OSC addresses of the replies in f.
+func (f sysField) addresses() []string {
+	var a []string
+	for i, address := range sysFieldAddresses {
+		if f&(1<<uint(i)) != 0 {
+			a = append(a, address)
+		}
+	}
+	return a
+}
+
+// An InfoError is returned when a device doesn't send all the requested /sys/* replies in time.
+type InfoError struct {
+	Missing []string // The addresses of the replies that never arrived.
+	Err     error    // The context error.
+}
+
+func (e *InfoError) Error() string {
+	return "no reply for " + strings.Join(e.Missing, ", ") + ": " + e.Err.Error()
+}
+
+// Unwrap returns the context error.
+func (e *InfoError) Unwrap() error {
+	return e.Err
+}
+
+// newDevice creates a connection to the serialosc device at the given address
+// and registers the /sys/* handlers. If an empty prefix is given, it defaults to /gopher.
+// Device specific handlers should be registered before calling start.
+func newDevice(address, prefix string) (*device, error) {
+	conn, err := newOscConnection(address)
+	if err != nil {
+		return nil, err
+	}
+	if prefix == "" {
+		prefix = "/gopher"
+	}
+	d := &device{
+		oscConnection: conn,
+		prefix:        prefix,
+		prefixed:      make(map[string]osc.HandlerFunc),
+		updated:       make(chan struct{}),
+	}
+	d.handle("/sys/port", d.handlePort)
+	d.handle("/sys/id", d.handleId)
+	d.handle("/sys/size", d.handleSize)
+	d.handle("/sys/prefix", d.handlePrefix)
+	d.handle("/sys/rotation", d.handleRotation)
+	return d, nil
+}
+
+// handlePrefixed registers f for messages sent to address under the device prefix,
+// such as /grid/key. The handler follows the prefix when it is changed.
+func (d *device) handlePrefixed(address string, f osc.HandlerFunc) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.prefixed[address] = f
+	d.handle(d.prefix+address, f)
+}
+
+// start starts the local OSC server, configures the device and requests the device information.
+// The connection is closed if any of the messages can't be sent.
+func (d *device) start() error {
+	d.serve()
+	err := d.configure()
+	if err != nil {
+		d.Close()
+		return err
+	}
+	return nil
+}
+
+// configure directs the device to send its messages to the local OSC server
+// and requests the device information.
+func (d *device) configure() error {
+	host, port := d.HostPort()
+	err := d.send("/sys/host", host)
+	if err != nil {
+		return err
+	}
+	err = d.send("/sys/port", int32(port))
+	if err != nil {
+		return err
+	}
+	err = d.send("/sys/prefix", d.Prefix())
+	if err != nil {
+		return err
+	}
+	return d.send("/sys/info")
+}
+
+// received marks the reply f as received.
+// It must be called with d.mu held.
+func (d *device) received(f sysField) {
+	d.seen |= f
+	close(d.updated)
+	d.updated = make(chan struct{})
+}
+
+// wait blocks until all the replies in f have been received.
+// An *InfoError is returned if ctx is done first.
+func (d *device) wait(ctx context.Context, f sysField) error {
+	return d.waitUntil(ctx, f, func() bool { return f&^d.seen == 0 })
+}
+
+// waitUntil blocks until done returns true, calling it with d.mu held every time
+// a reply is received. If ctx is done first, an *InfoError is returned with the
+// replies in f that have not been received as missing, or all of f if they all have.
+func (d *device) waitUntil(ctx context.Context, f sysField, done func() bool) error {
+	for {
+		d.mu.RLock()
+		ok := done()
+		missing := f &^ d.seen
+		updated := d.updated
+		d.mu.RUnlock()
+		if ok {
+			return nil
+		}
+		select {
+		case <-updated:
+		case <-ctx.Done():
+			if missing == 0 {
+				missing = f
+			}
+			return &InfoError{Missing: missing.addresses(), Err: ctx.Err()}
+		}
+	}
+}
+
+// SetPrefix changes the prefix of the messages sent to and from the device,
+// and waits until the device confirms the new prefix. If ctx is done first,
+// an *InfoError is returned and the device may or may not use the new prefix.
+func (d *device) SetPrefix(ctx context.Context, prefix string) error {
+	err := d.send("/sys/prefix", prefix)
+	if err != nil {
+		return err
+	}
+	return d.waitUntil(ctx, sysPrefix, func() bool { return d.prefix == prefix })
+}
+
+// SetRotation asks the device to rotate its coordinates clockwise by 0, 90, 180 or 270 degrees,
+// and waits until the device confirms the new rotation. If ctx is done first, an *InfoError is returned.
+// The rotation is done by serialosc, which may then report a different size; use Refresh to update it.
+func (d *device) SetRotation(ctx context.Context, degrees int) error {
+	if err := checkRotation(degrees); err != nil {
+		return err
+	}
+	err := d.send("/sys/rotation", int32(degrees))
+	if err != nil {
+		return err
+	}
+	return d.waitUntil(ctx, sysRotation, func() bool { return d.rotation == degrees })
+}
+
+// Refresh requests the device information again with /sys/info and waits until
+// the device has replied with its id, size, prefix and rotation.
+// If ctx is done first, the returned *InfoError lists the replies that never arrived.
+func (d *device) Refresh(ctx context.Context) error {
+	d.mu.Lock()
+	d.seen = 0
+	d.mu.Unlock()
+	err := d.send("/sys/info")
+	if err != nil {
+		return err
+	}
+	return d.wait(ctx, sysId|sysSize|sysPrefix|sysRotation)
+}
+
+// Id returns the id of the connected Monome device.
+func (d *device) Id() string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.id
+}
+
+// Prefix returns the OSC prefinx being used in communication with the connected Monome device.
+func (d *device) Prefix() string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.prefix
+}
+
+// Rotation returns the rotation of the connected Monome device.
+func (d *device) Rotation() int {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.rotation
+}
+
+func (d *device) handlePort(msg *osc.Message) {
+	return
+}
+
+func (d *device) handleId(msg *osc.Message) {
+	if msg.CountArguments() != 1 {
+		return
+	}
+	id, ok := msg.Arguments[0].(string)
+	if !ok {
+		return
+	}
+	d.mu.Lock()
+	d.id = id
+	d.received(sysId)
+	d.mu.Unlock()
+}
+
+func (d *device) handleSize(msg *osc.Message) {
+	if msg.CountArguments() != 2 {
+		return
+	}
+	width, ok := msg.Arguments[0].(int32)
+	if !ok {
+		return
+	}
+	height, ok := msg.Arguments[1].(int32)
+	if !ok {
+		return
+	}
+	d.mu.Lock()
+	d.width = int(width)
+	d.height = int(height)
+	d.received(sysSize)
+	d.mu.Unlock()
+}
+
+func (d *device) handlePrefix(msg *osc.Message) {
+	if msg.CountArguments() != 1 {
+		return
+	}
+	prefix, ok := msg.Arguments[0].(string)
+	if !ok {
+		return
+	}
+	d.mu.Lock()
+	if prefix != d.prefix {
+		for address, f := range d.prefixed {
+			d.unhandle(d.prefix + address)
+			d.handle(prefix+address, f)
+		}
+	}
+	d.prefix = prefix
+	d.received(sysPrefix)
+	d.mu.Unlock()
+}
+
+func (d *device) handleRotation(msg *osc.Message) {
+	if msg.CountArguments() != 1 {
+		return
+	}
+	rotation, ok := msg.Arguments[0].(int32)
+	if !ok {
+		return
+	}
+	d.mu.Lock()
+	d.rotation = int(rotation)
+	d.received(sysRotation)
+	d.mu.Unlock()
+}
@@ -0,0 +1,246 @@
+package monome
+
+// Drawing primitives for LEDBuffer. All of them clip to the bounds of the buffer,
+// so shapes may extend past its edges, and clamp levels to the range [0, 15].
+
+// Line draws a line of the given level from (x0, y0) to (x1, y1), both ends included.
+func (b *LEDBuffer) Line(x0, y0, x1, y1, level int) {
+	level = clampLevel(level)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.line(x0, y0, x1, y1, level)
+}
+
+// line draws a line using Bresenham's algorithm.
+func (b *LEDBuffer) line(x0, y0, x1, y1, level int) {
+	dx, sx := abs(x1-x0), 1
+	if x0 > x1 {
+		sx = -1
+	}
+	dy, sy := -abs(y1-y0), 1
+	if y0 > y1 {
+		sy = -1
+	}
+	e := dx + dy
+	for {
+		b.setLevel(x0, y0, level)
+		if x0 == x1 && y0 == y1 {
+			return
+		}
+		if 2*e >= dy {
+			e += dy
+			x0 += sx
+		}
+		if 2*e <= dx {
+			e += dx
+			y0 += sy
+		}
+	}
+}
+
+// Rect draws the outline of a w by h rectangle with its top left corner at (x, y).
+func (b *LEDBuffer) Rect(x, y, w, h, level int) {
+	level = clampLevel(level)
+	if w <= 0 || h <= 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.line(x, y, x+w-1, y, level)
+	b.line(x, y+h-1, x+w-1, y+h-1, level)
+	b.line(x, y, x, y+h-1, level)
+	b.line(x+w-1, y, x+w-1, y+h-1, level)
+}
+
+// FillRect fills a w by h rectangle with its top left corner at (x, y).
+func (b *LEDBuffer) FillRect(x, y, w, h, level int) {
+	level = clampLevel(level)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for j := y; j < y+h; j++ {
+		for i := x; i < x+w; i++ {
+			b.setLevel(i, j, level)
+		}
+	}
+}
+
+// Circle draws the outline of a circle of radius r centered on (cx, cy).
+func (b *LEDBuffer) Circle(cx, cy, r, level int) {
+	level = clampLevel(level)
+	if r < 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	// Midpoint circle algorithm, drawing all eight octants at once.
+	x, y, e := r, 0, 1-r
+	for x >= y {
+		for _, p := range [8][2]int{
+			{x, y}, {y, x}, {-y, x}, {-x, y},
+			{-x, -y}, {-y, -x}, {y, -x}, {x, -y},
+		} {
+			b.setLevel(cx+p[0], cy+p[1], level)
+		}
+		y++
+		if e < 0 {
+			e += 2*y + 1
+		} else {
+			x--
+			e += 2*(y-x) + 1
+		}
+	}
+}
+
+// FillCircle fills a circle of radius r centered on (cx, cy).
+func (b *LEDBuffer) FillCircle(cx, cy, r, level int) {
+	level = clampLevel(level)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for y := -r; y <= r; y++ {
+		for x := -r; x <= r; x++ {
+			if x*x+y*y <= r*r+r {
+				b.setLevel(cx+x, cy+y, level)
+			}
+		}
+	}
+}
+
+// FloodFill sets the level of the LED at (x, y) and of every LED connected to it
+// horizontally or vertically that has the same level.
+func (b *LEDBuffer) FloodFill(x, y, level int) {
+	level = clampLevel(level)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.inBounds(x, y) {
+		return
+	}
+	target := b.Buf[x+y*b.width]
+	if target == level {
+		return
+	}
+	stack := [][2]int{{x, y}}
+	for len(stack) > 0 {
+		p := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		x, y := p[0], p[1]
+		if !b.inBounds(x, y) || b.Buf[x+y*b.width] != target {
+			continue
+		}
+		b.Buf[x+y*b.width] = level
+		stack = append(stack, [2]int{x + 1, y}, [2]int{x - 1, y}, [2]int{x, y + 1}, [2]int{x, y - 1})
+	}
+}
+
+// Blit copies the w by h region of src with its top left corner at (sx, sy)
+// to the region of b with its top left corner at (dx, dy).
+// Parts of the region outside of either buffer are skipped. src may be b.
+func (b *LEDBuffer) Blit(src *LEDBuffer, sx, sy, w, h, dx, dy int) {
+	levels := src.Snapshot()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if !src.inBounds(sx+x, sy+y) {
+				continue
+			}
+			b.setLevel(dx+x, dy+y, levels[sx+x+(sy+y)*src.width])
+		}
+	}
+}
+
+// Copy copies the w by h region of the buffer with its top left corner at (sx, sy)
+// to (dx, dy). The regions may overlap.
+func (b *LEDBuffer) Copy(sx, sy, w, h, dx, dy int) {
+	b.Blit(b, sx, sy, w, h, dx, dy)
+}
+
+// Scroll moves the contents of the buffer by dx columns and dy rows,
+// wrapping LEDs that move past an edge around to the opposite edge.
+func (b *LEDBuffer) Scroll(dx, dy int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	levels := append([]int(nil), b.Buf...)
+	for y := 0; y < b.height; y++ {
+		for x := 0; x < b.width; x++ {
+			nx, ny := mod(x+dx, b.width), mod(y+dy, b.height)
+			b.Buf[nx+ny*b.width] = levels[x+y*b.width]
+		}
+	}
+}
+
+// Shift moves the contents of the buffer by dx columns and dy rows,
+// discarding LEDs that move past an edge and setting the uncovered LEDs to fill.
+func (b *LEDBuffer) Shift(dx, dy, fill int) {
+	fill = clampLevel(fill)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	levels := append([]int(nil), b.Buf...)
+	b.fill(fill)
+	for y := 0; y < b.height; y++ {
+		for x := 0; x < b.width; x++ {
+			b.setLevel(x+dx, y+dy, levels[x+y*b.width])
+		}
+	}
+}
+
+// HorizontalGradient fills a w by h rectangle with its top left corner at (x, y)
+// with levels going from from in its leftmost column to to in its rightmost column.
+func (b *LEDBuffer) HorizontalGradient(x, y, w, h, from, to int) {
+	from, to = clampLevel(from), clampLevel(to)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for i := 0; i < w; i++ {
+		level := interpolate(from, to, i, w)
+		for j := y; j < y+h; j++ {
+			b.setLevel(x+i, j, level)
+		}
+	}
+}
+
+// VerticalGradient fills a w by h rectangle with its top left corner at (x, y)
+// with levels going from from in its top row to to in its bottom row.
+func (b *LEDBuffer) VerticalGradient(x, y, w, h, from, to int) {
+	from, to = clampLevel(from), clampLevel(to)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for j := 0; j < h; j++ {
+		level := interpolate(from, to, j, h)
+		for i := x; i < x+w; i++ {
+			b.setLevel(i, y+j, level)
+		}
+	}
+}
+
+// inBounds reports whether (x, y) is inside the buffer.
+func (b *LEDBuffer) inBounds(x, y int) bool {
+	return x >= 0 && y >= 0 && x < b.width && y < b.height
+}
+
+// interpolate returns the level at step i of n going from from to to, rounded to the nearest level.
+func interpolate(from, to, i, n int) int {
+	if n <= 1 {
+		return from
+	}
+	d := (to - from) * i
+	// Round half away from zero.
+	if d < 0 {
+		return from - (-2*d+n-1)/(2*(n-1))
+	}
+	return from + (2*d+n-1)/(2*(n-1))
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// mod returns x modulo n in the range [0, n).
+func mod(x, n int) int {
+	x %= n
+	if x < 0 {
+		x += n
+	}
+	return x
+}
@@ -0,0 +1,159 @@
+package monome
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// picture returns the levels in b as rows of hexadecimal digits, with '.' for LEDs that are off.
+func picture(b *LEDBuffer) []string {
+	const digits = ".123456789abcdef"
+	var rows []string
+	for y := 0; y < b.height; y++ {
+		var row strings.Builder
+		for x := 0; x < b.width; x++ {
+			row.WriteByte(digits[b.Buf[x+y*b.width]])
+		}
+		rows = append(rows, row.String())
+	}
+	return rows
+}
+
+func TestDraw(t *testing.T) {
+	tests := []struct {
+		name string
+		draw func(b *LEDBuffer)
+		want []string
+	}{
+		{"line", func(b *LEDBuffer) { b.Line(0, 0, 7, 3, 15) }, []string{
+			"f.......",
+			".ff.....",
+			"...ff...",
+			".....fff",
+			"........",
+			"........",
+		}},
+		{"clipped line", func(b *LEDBuffer) { b.Line(-2, 5, 10, 5, 1) }, []string{
+			"........",
+			"........",
+			"........",
+			"........",
+			"........",
+			"11111111",
+		}},
+		{"rect", func(b *LEDBuffer) { b.Rect(1, 1, 4, 3, 5) }, []string{
+			"........",
+			".5555...",
+			".5..5...",
+			".5555...",
+			"........",
+			"........",
+		}},
+		{"fill rect", func(b *LEDBuffer) { b.FillRect(6, 4, 4, 4, 9) }, []string{
+			"........",
+			"........",
+			"........",
+			"........",
+			"......99",
+			"......99",
+		}},
+		{"circle", func(b *LEDBuffer) { b.Circle(3, 2, 2, 15) }, []string{
+			"..fff...",
+			".f...f..",
+			".f...f..",
+			".f...f..",
+			"..fff...",
+			"........",
+		}},
+		{"fill circle", func(b *LEDBuffer) { b.FillCircle(3, 2, 2, 15) }, []string{
+			"..fff...",
+			".fffff..",
+			".fffff..",
+			".fffff..",
+			"..fff...",
+			"........",
+		}},
+		{"flood fill", func(b *LEDBuffer) { b.Rect(0, 0, 4, 4, 15); b.FloodFill(1, 1, 3) }, []string{
+			"ffff....",
+			"f33f....",
+			"f33f....",
+			"ffff....",
+			"........",
+			"........",
+		}},
+		{"copy", func(b *LEDBuffer) { b.Line(0, 0, 2, 0, 7); b.Copy(0, 0, 3, 1, 1, 1) }, []string{
+			"777.....",
+			".777....",
+			"........",
+			"........",
+			"........",
+			"........",
+		}},
+		{"scroll", func(b *LEDBuffer) { b.LEDLevelSet(0, 0, 1); b.LEDLevelSet(7, 5, 2); b.Scroll(1, -1) }, []string{
+			"........",
+			"........",
+			"........",
+			"........",
+			"2.......",
+			".1......",
+		}},
+		{"shift", func(b *LEDBuffer) { b.LEDLevelSet(0, 0, 1); b.LEDLevelSet(7, 5, 2); b.Shift(1, -1, 4) }, []string{
+			"4.......",
+			"4.......",
+			"4.......",
+			"4.......",
+			"4.......",
+			"44444444",
+		}},
+		{"horizontal gradient", func(b *LEDBuffer) { b.HorizontalGradient(0, 0, 8, 2, 0, 14) }, []string{
+			".2468ace",
+			".2468ace",
+			"........",
+			"........",
+			"........",
+			"........",
+		}},
+		{"vertical gradient", func(b *LEDBuffer) { b.VerticalGradient(0, 0, 1, 6, 15, 5) }, []string{
+			"f.......",
+			"d.......",
+			"b.......",
+			"9.......",
+			"7.......",
+			"5.......",
+		}},
+		{"clamped levels", func(b *LEDBuffer) {
+			b.FillRect(0, 0, 3, 2, 99)
+			b.Line(0, 0, 0, 1, -4)
+			b.HorizontalGradient(0, 3, 4, 1, -8, 40)
+		}, []string{
+			".ff.....",
+			".ff.....",
+			"........",
+			".5af....",
+			"........",
+			"........",
+		}},
+	}
+	for _, test := range tests {
+		b := NewLEDBuffer(8, 6)
+		test.draw(b)
+		if got := picture(b); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got\n%s\nwant\n%s", test.name, strings.Join(got, "\n"), strings.Join(test.want, "\n"))
+		}
+	}
+}
+
+func TestBlit(t *testing.T) {
+	src := NewLEDBuffer(4, 4)
+	src.FillRect(0, 0, 4, 4, 8)
+	dst := NewLEDBuffer(8, 2)
+	dst.Blit(src, 2, 2, 4, 4, 6, 0)
+	want := []string{
+		"......88",
+		"......88",
+	}
+	if got := picture(dst); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
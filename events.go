@@ -0,0 +1,216 @@
+package monome
+
+import (
+	"sync"
+)
+
+// OverflowPolicy decides what happens to events that arrive faster than they are read
+// from their channel.
+type OverflowPolicy int
+
+// DefaultQueueSize is the number of events queued for each channel until
+// SetOverflowPolicy is called.
+const DefaultQueueSize = 64
+
+const (
+	// Block queues events and, while the queue is full, waits for the channel to take
+	// one before accepting a new one, so no event is lost. This is the default.
+	// While it waits no other messages from the device are handled, so a channel
+	// that is never read stops the grid once its queue is full.
+	Block OverflowPolicy = iota
+	// DropOldest queues events and discards the oldest queued event to make room for a new one.
+	DropOldest
+	// DropNewest queues events and discards new events while the queue is full.
+	DropNewest
+	// Coalesce queues events and replaces a queued event for the same key, or the same
+	// tilt sensor, with the new one, so only the latest state of each is delivered.
+	Coalesce
+)
+
+// eventQueue delivers events to a channel according to an OverflowPolicy.
+// Events are queued and delivered by their own goroutine, so that a slow reader
+// only holds up the handling of device messages once the queue is full, and then
+// only with Block.
+type eventQueue struct {
+	mu      sync.Mutex // protects the fields below
+	policy  OverflowPolicy
+	size    int
+	pending []queuedEvent
+	started bool
+
+	wake      chan struct{} // signalled when an event is queued
+	room      chan struct{} // signalled when an event is taken from the queue
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+// queuedEvent is an event waiting to be delivered.
+type queuedEvent struct {
+	key  interface{}                // events with equal keys are coalesced
+	send func(done <-chan struct{}) // delivers the event, giving up when done is closed
+}
+
+func newEventQueue() *eventQueue {
+	return &eventQueue{
+		size: DefaultQueueSize,
+		wake: make(chan struct{}, 1),
+		room: make(chan struct{}, 1),
+		done: make(chan struct{}),
+	}
+}
+
+// setPolicy sets the policy used for new events and the maximum number of queued events.
+func (q *eventQueue) setPolicy(policy OverflowPolicy, size int) {
+	if size < 1 {
+		size = 1
+	}
+	q.mu.Lock()
+	q.policy = policy
+	q.size = size
+	q.mu.Unlock()
+}
+
+// push delivers an event identified by key with send, following the policy.
+func (q *eventQueue) push(key interface{}, send func(done <-chan struct{})) {
+	q.mu.Lock()
+	for q.policy == Block && len(q.pending) >= q.size {
+		q.mu.Unlock()
+		select {
+		case <-q.room:
+		case <-q.done:
+			return
+		}
+		q.mu.Lock()
+	}
+	ev := queuedEvent{key, send}
+	switch {
+	case q.policy == Coalesce && q.replace(ev):
+		q.mu.Unlock()
+		return
+	case q.policy == Coalesce || len(q.pending) < q.size:
+		q.pending = append(q.pending, ev)
+	case q.policy == DropOldest:
+		q.pending = append(q.pending[1:], ev)
+	default:
+		q.mu.Unlock()
+		return
+	}
+	if !q.started {
+		q.started = true
+		go q.run()
+	}
+	q.mu.Unlock()
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// replace replaces the queued event with the same key as ev, if any.
+// It must be called with q.mu held.
+func (q *eventQueue) replace(ev queuedEvent) bool {
+	for i := range q.pending {
+		if q.pending[i].key == ev.key {
+			q.pending[i] = ev
+			return true
+		}
+	}
+	return false
+}
+
+// run delivers the queued events until the queue is closed.
+func (q *eventQueue) run() {
+	for {
+		q.mu.Lock()
+		if len(q.pending) == 0 {
+			q.mu.Unlock()
+			select {
+			case <-q.wake:
+				continue
+			case <-q.done:
+				return
+			}
+		}
+		ev := q.pending[0]
+		q.pending = q.pending[1:]
+		q.mu.Unlock()
+		select {
+		case q.room <- struct{}{}:
+		default:
+		}
+		ev.send(q.done)
+	}
+}
+
+// close stops delivering events, discarding any that are queued.
+func (q *eventQueue) close() {
+	q.closeOnce.Do(func() {
+		close(q.done)
+	})
+}
+
+// SetOverflowPolicy sets what happens to key and tilt events that arrive faster than
+// they are read from their channels. With Block, DropOldest and DropNewest at most size
+// events are queued for each channel, a size below 1 is treated as 1. The size is not
+// used by Coalesce.
+func (g *Grid) SetOverflowPolicy(policy OverflowPolicy, size int) {
+	g.keyQueue.setPolicy(policy, size)
+	g.tiltQueue.setPolicy(policy, size)
+}
+
+// HandleKey sets a function that is called with every key event, in addition to
+// sending it to the key event channel. f is called from the goroutine that handles
+// the messages from the device, so it must not block. A nil f removes the handler.
+func (g *Grid) HandleKey(f func(e KeyEvent)) {
+	g.mu.Lock()
+	g.keyHandler = f
+	g.mu.Unlock()
+}
+
+// HandleTilt is like HandleKey for tilt events. Tilt data is only sent by the
+// device once the sensor is enabled with TiltSet.
+func (g *Grid) HandleTilt(f func(e TiltEvent)) {
+	g.mu.Lock()
+	g.tiltHandler = f
+	g.mu.Unlock()
+}
+
+// deliverKey passes e to the key handler and the key event channel.
+func (g *Grid) deliverKey(e KeyEvent) {
+	g.mu.RLock()
+	f := g.keyHandler
+	g.mu.RUnlock()
+	if f != nil {
+		f(e)
+	}
+	events := g.events
+	if events == nil {
+		return
+	}
+	g.keyQueue.push([2]int{e.X, e.Y}, func(done <-chan struct{}) {
+		select {
+		case events <- e:
+		case <-done:
+		}
+	})
+}
+
+// deliverTilt passes e to the tilt handler and the tilt event channel.
+func (g *Grid) deliverTilt(e TiltEvent) {
+	g.mu.RLock()
+	f := g.tiltHandler
+	events := g.tilt
+	g.mu.RUnlock()
+	if f != nil {
+		f(e)
+	}
+	if events == nil {
+		return
+	}
+	g.tiltQueue.push(e.N, func(done <-chan struct{}) {
+		select {
+		case events <- e:
+		case <-done:
+		}
+	})
+}
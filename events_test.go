@@ -0,0 +1,75 @@
+package monome
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestEventQueuePolicies(t *testing.T) {
+	tests := []struct {
+		policy OverflowPolicy
+		want   []int
+	}{
+		{DropOldest, []int{3, 4}},
+		{DropNewest, []int{0, 1}},
+		{Coalesce, []int{4, 1, 2, 3}},
+	}
+	for _, test := range tests {
+		q := newEventQueue()
+		q.setPolicy(test.policy, 2)
+		// Keep the events queued by not starting the goroutine delivering them.
+		q.started = true
+
+		var got []int
+		for i := 0; i < 5; i++ {
+			i := i
+			// Events 0 and 4 are for the same key.
+			q.push(i%4, func(done <-chan struct{}) { got = append(got, i) })
+		}
+		for _, ev := range q.pending {
+			ev.send(nil)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("policy %d: got events %v, want %v", test.policy, got, test.want)
+		}
+	}
+}
+
+func TestEventQueueBlock(t *testing.T) {
+	q := newEventQueue()
+	defer q.close()
+	q.setPolicy(Block, 1)
+	events := make(chan int)
+	pushed := make(chan struct{})
+	go func() {
+		defer close(pushed)
+		for i := 0; i < 5; i++ {
+			i := i
+			q.push(nil, func(done <-chan struct{}) {
+				select {
+				case events <- i:
+				case <-done:
+				}
+			})
+		}
+	}()
+
+	// One event is being sent and one is queued, so the rest wait for room.
+	select {
+	case <-pushed:
+		t.Fatal("all events were accepted while none were read")
+	case <-time.After(20 * time.Millisecond):
+	}
+	for i := 0; i < 5; i++ {
+		select {
+		case e := <-events:
+			if e != i {
+				t.Fatalf("got event %d, want %d", e, i)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for event %d", i)
+		}
+	}
+	<-pushed
+}
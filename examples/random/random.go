@@ -11,14 +11,13 @@ import (
 	"github.com/kisielk/monome"
 )
 
-func makeRandomLights(b *monome.LEDBuffer, d *monome.Grid) {
-	rand.Seed(time.Now().UnixNano())
-
+func makeRandomLights(r *monome.Renderer) {
 	// fill buffer with random values from 0-15
-	for i := range b.Buf {
-		b.Buf[i] = rand.Intn(15)
-	}
-	b.Render(d)
+	r.Draw(func(b *monome.LEDBuffer) {
+		for i := range b.Buf {
+			b.Buf[i] = rand.Intn(15)
+		}
+	})
 }
 
 func main() {
@@ -31,11 +30,13 @@ func main() {
 		log.Fatal(err)
 	}
 
-	b := monome.NewLEDBuffer(grid.Width(), grid.Height())
+	rand.Seed(time.Now().UnixNano())
+	r := monome.NewRenderer(grid, grid.Width(), grid.Height(), 30)
 
 	go func() {
 		<-c
 		fmt.Printf("\nShutting Down...\n")
+		r.Close()
 		time.Sleep(1 * time.Second)
 		grid.LEDAll(0)
 		grid.Close()
@@ -44,6 +45,6 @@ func main() {
 
 	for {
 		time.Sleep(500 * time.Millisecond)
-		makeRandomLights(b, grid)
+		makeRandomLights(r)
 	}
 }
@@ -2,9 +2,11 @@ module grid-websockets
 
 go 1.17
 
-require github.com/gorilla/websocket v1.4.2
-
 require (
-	github.com/kisielk/go-osc v0.0.0-20150323163941-f2f83b76cb24 // indirect
-	github.com/kisielk/monome v0.0.0-20220110231529-d50cbcf26d35 // indirect
+	github.com/gorilla/websocket v1.4.2
+	github.com/kisielk/monome v0.0.0-20220110231529-d50cbcf26d35
 )
+
+require github.com/kisielk/go-osc v0.0.0-20150323163941-f2f83b76cb24 // indirect
+
+replace github.com/kisielk/monome => ../..
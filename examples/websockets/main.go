@@ -29,8 +29,8 @@ func main() {
 
 	localBuffer := monome.NewLEDBuffer(grid.Width(), grid.Height())
 
-	go webGridMessageHandler(gmc, *grid, localBuffer)
-	go gridKeyHandler(kec, *grid, localBuffer, gmk)
+	go webGridMessageHandler(gmc, grid, localBuffer)
+	go gridKeyHandler(kec, grid, localBuffer, gmk)
 
 	grid.LEDAll(0)
 
@@ -71,19 +71,14 @@ func readWs(conn *websocket.Conn, gmc chan gridmsg) {
 	}
 }
 
-func gridKeyHandler(gke chan monome.KeyEvent, g monome.Grid, localBuffer *monome.LEDBuffer, gmk chan gridmsg) {
+func gridKeyHandler(gke chan monome.KeyEvent, g *monome.Grid, localBuffer *monome.LEDBuffer, gmk chan gridmsg) {
 	for {
 		m := <-gke
-		i := localBuffer.GetIndexFromXY(m.X, m.Y)
 		if m.State == 1 {
-			if localBuffer.Buf[i] == 0 {
-				localBuffer.Buf[i] = 15
-			} else {
-				localBuffer.Buf[i] = 0
-			}
+			localBuffer.Toggle(m.X, m.Y, 15)
 		}
-		localBuffer.Render(&g)
-		gmk <- gridmsg{Cmd: "fromGridBuffer", Data: localBuffer.Buf}
+		localBuffer.Render(g)
+		gmk <- gridmsg{Cmd: "fromGridBuffer", Data: localBuffer.Snapshot()}
 	}
 }
 
@@ -97,13 +92,17 @@ func localGridMessageHandler(conn *websocket.Conn, gmk chan gridmsg) {
 	}
 }
 
-func webGridMessageHandler(gmc chan gridmsg, g monome.Grid, b *monome.LEDBuffer) {
+func webGridMessageHandler(gmc chan gridmsg, g *monome.Grid, b *monome.LEDBuffer) {
 	for {
 		m := <-gmc
 		switch m.Cmd {
 		case "levelMap":
-			b.Buf = m.Data
-			b.Render(&g)
+			_, err := b.Swap(m.Data)
+			if err != nil {
+				log.Println(err)
+				continue
+			}
+			b.Render(g)
 		}
 	}
 }
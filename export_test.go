@@ -0,0 +1,5 @@
+package monome
+
+// ConnectAddress is ConnectContext using the serialosc instance at the given address,
+// so that tests can connect through a fake serialosc.
+var ConnectAddress = connectContext
@@ -0,0 +1,298 @@
+// Package gesture recognizes taps, long presses, ranges and chords in the key events
+// from a monome grid.
+package gesture
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/kisielk/monome"
+)
+
+// Default timings used by a Recognizer when its fields are zero.
+const (
+	DefaultLongPress   = 500 * time.Millisecond
+	DefaultDoubleTap   = 300 * time.Millisecond
+	DefaultChordWindow = 50 * time.Millisecond
+)
+
+// Kind is the kind of a gesture.
+type Kind int
+
+const (
+	// Tap is a key released before it was held long enough to be a long press.
+	Tap Kind = iota
+	// DoubleTap is a tap that follows a tap of the same key within the double tap interval.
+	// It is sent after the Tap event for the second tap.
+	DoubleTap
+	// LongPress is a key that has been held for the long press threshold.
+	// It is sent while the key is still held.
+	LongPress
+	// HoldRelease is the release of a key after a LongPress.
+	HoldRelease
+	// Range is a key pressed while another key is held, outside of the chord window.
+	// The first key of the event is the held key and the second is the new one.
+	Range
+	// Chord is two or more keys pressed within the chord window of each other.
+	Chord
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Tap:
+		return "tap"
+	case DoubleTap:
+		return "double tap"
+	case LongPress:
+		return "long press"
+	case HoldRelease:
+		return "hold and release"
+	case Range:
+		return "range"
+	case Chord:
+		return "chord"
+	}
+	return "unknown"
+}
+
+// Key is the position of a key on the grid.
+type Key struct {
+	X, Y int
+}
+
+// Event is a recognized gesture.
+type Event struct {
+	Kind Kind
+	Keys []Key     // The keys that make up the gesture, in the order they were pressed.
+	Time time.Time // When the gesture was completed.
+	// How long the key was held, for LongPress and HoldRelease.
+	Duration time.Duration
+}
+
+// Recognizer turns key events into gestures.
+//
+// The keys of a Range or Chord are taken by that gesture: they don't also produce
+// taps or long presses. A long press of the first key of a range is sent if the
+// threshold passes before the second key is pressed.
+type Recognizer struct {
+	LongPress   time.Duration // How long a key is held to be a long press, DefaultLongPress if 0.
+	DoubleTap   time.Duration // The longest time between two taps of a double tap, DefaultDoubleTap if 0.
+	ChordWindow time.Duration // The longest time between the first and last key of a chord, DefaultChordWindow if 0.
+}
+
+// press is a key that is held.
+type press struct {
+	at    time.Time // when the key was pressed
+	long  bool      // whether a LongPress was sent
+	taken bool      // whether the key is part of a range or a chord
+}
+
+// state is the state of a running Recognizer.
+type state struct {
+	r          *Recognizer
+	held       map[Key]*press
+	chord      []Key     // the keys pressed since chordStart, while the chord window is open
+	chordStart time.Time // when the first key of chord was pressed
+	taps       map[Key]time.Time
+	out        []Event // events waiting to be sent
+}
+
+// Run reads key events from keys and sends the gestures they make to gestures, until
+// keys is closed or ctx is done. It returns nil when keys is closed and ctx.Err() otherwise.
+//
+// Durations are measured with the Time of the key events, or the time they are read
+// from keys if Time is zero.
+func (r *Recognizer) Run(ctx context.Context, keys <-chan monome.KeyEvent, gestures chan<- Event) error {
+	s := &state{
+		r:    r,
+		held: make(map[Key]*press),
+		taps: make(map[Key]time.Time),
+	}
+	timer := time.NewTimer(time.Hour)
+	timer.Stop()
+	defer timer.Stop()
+	for {
+		for len(s.out) > 0 {
+			select {
+			case gestures <- s.out[0]:
+				s.out = s.out[1:]
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		if next, ok := s.deadline(); ok {
+			timer.Reset(time.Until(next))
+		}
+		select {
+		case e, ok := <-keys:
+			if !ok {
+				return nil
+			}
+			if e.Time.IsZero() {
+				e.Time = time.Now()
+			}
+			s.key(e)
+		case <-timer.C:
+			s.expire(time.Now())
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+	}
+}
+
+func (r *Recognizer) longPress() time.Duration {
+	if r.LongPress > 0 {
+		return r.LongPress
+	}
+	return DefaultLongPress
+}
+
+func (r *Recognizer) doubleTap() time.Duration {
+	if r.DoubleTap > 0 {
+		return r.DoubleTap
+	}
+	return DefaultDoubleTap
+}
+
+func (r *Recognizer) chordWindow() time.Duration {
+	if r.ChordWindow > 0 {
+		return r.ChordWindow
+	}
+	return DefaultChordWindow
+}
+
+// emit queues an event to be sent.
+func (s *state) emit(kind Kind, t time.Time, d time.Duration, keys ...Key) {
+	s.out = append(s.out, Event{Kind: kind, Keys: keys, Time: t, Duration: d})
+}
+
+// key handles a key event.
+func (s *state) key(e monome.KeyEvent) {
+	k := Key{e.X, e.Y}
+	if e.State == 1 {
+		s.down(k, e.Time)
+	} else {
+		s.up(k, e.Time)
+	}
+}
+
+// down handles a key press at t.
+func (s *state) down(k Key, t time.Time) {
+	if _, ok := s.held[k]; ok {
+		return
+	}
+	// Anything that should have happened before t happens first.
+	s.expire(t)
+	p := &press{at: t}
+	switch {
+	case len(s.chord) > 0:
+		s.chord = append(s.chord, k)
+		for _, c := range s.chord {
+			if h, ok := s.held[c]; ok {
+				h.taken = true
+			}
+		}
+		p.taken = true
+	case len(s.held) == 0:
+		s.chord = []Key{k}
+		s.chordStart = t
+	default:
+		first := s.first()
+		s.held[first].taken = true
+		p.taken = true
+		s.emit(Range, t, 0, first, k)
+	}
+	s.held[k] = p
+}
+
+// up handles a key release at t.
+func (s *state) up(k Key, t time.Time) {
+	p, ok := s.held[k]
+	if !ok {
+		return
+	}
+	s.expire(t)
+	delete(s.held, k)
+	if len(s.chord) == 1 && s.chord[0] == k {
+		s.chord = nil
+	}
+	if p.taken {
+		return
+	}
+	d := t.Sub(p.at)
+	if d >= s.r.longPress() {
+		if !p.long {
+			s.emit(LongPress, p.at.Add(s.r.longPress()), s.r.longPress(), k)
+		}
+		s.emit(HoldRelease, t, d, k)
+		delete(s.taps, k)
+		return
+	}
+	s.emit(Tap, t, 0, k)
+	if last, ok := s.taps[k]; ok && p.at.Sub(last) <= s.r.doubleTap() {
+		s.emit(DoubleTap, t, 0, k)
+		delete(s.taps, k)
+		return
+	}
+	s.taps[k] = t
+}
+
+// expire sends the gestures whose time has come by t: chords whose window has closed
+// and long presses of keys that are still held.
+func (s *state) expire(t time.Time) {
+	if len(s.chord) > 0 && !t.Before(s.chordStart.Add(s.r.chordWindow())) {
+		if len(s.chord) > 1 {
+			s.emit(Chord, s.chordStart.Add(s.r.chordWindow()), 0, s.chord...)
+		}
+		s.chord = nil
+	}
+	for _, k := range s.sorted() {
+		p := s.held[k]
+		if p.long || p.taken || t.Before(p.at.Add(s.r.longPress())) {
+			continue
+		}
+		p.long = true
+		s.emit(LongPress, p.at.Add(s.r.longPress()), s.r.longPress(), k)
+	}
+}
+
+// deadline returns the next time that expire has something to do.
+func (s *state) deadline() (time.Time, bool) {
+	var next time.Time
+	if len(s.chord) > 0 {
+		next = s.chordStart.Add(s.r.chordWindow())
+	}
+	for _, p := range s.held {
+		if p.long || p.taken {
+			continue
+		}
+		if t := p.at.Add(s.r.longPress()); next.IsZero() || t.Before(next) {
+			next = t
+		}
+	}
+	return next, !next.IsZero()
+}
+
+// sorted returns the held keys in the order they were pressed.
+func (s *state) sorted() []Key {
+	keys := make([]Key, 0, len(s.held))
+	for k := range s.held {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return s.held[keys[i]].at.Before(s.held[keys[j]].at)
+	})
+	return keys
+}
+
+// first returns the held key that was pressed first.
+func (s *state) first() Key {
+	return s.sorted()[0]
+}
@@ -0,0 +1,129 @@
+package gesture
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/kisielk/monome"
+)
+
+// step is a key event at a time in milliseconds, or an expiry of timers when x is -1.
+type step struct {
+	ms          int
+	x, y, state int
+}
+
+func TestRecognize(t *testing.T) {
+	r := &Recognizer{LongPress: 500 * time.Millisecond, DoubleTap: 300 * time.Millisecond, ChordWindow: 50 * time.Millisecond}
+	a, b, c := Key{0, 0}, Key{1, 0}, Key{2, 0}
+	for _, test := range []struct {
+		name  string
+		steps []step
+		want  []Event
+	}{
+		{
+			"tap",
+			[]step{{0, 0, 0, 1}, {100, 0, 0, 0}},
+			[]Event{{Kind: Tap, Keys: []Key{a}}},
+		},
+		{
+			"double tap",
+			[]step{{0, 0, 0, 1}, {100, 0, 0, 0}, {300, 0, 0, 1}, {350, 0, 0, 0}, {500, 0, 0, 1}, {550, 0, 0, 0}},
+			[]Event{
+				{Kind: Tap, Keys: []Key{a}},
+				{Kind: Tap, Keys: []Key{a}},
+				{Kind: DoubleTap, Keys: []Key{a}},
+				{Kind: Tap, Keys: []Key{a}},
+			},
+		},
+		{
+			"taps too far apart",
+			[]step{{0, 0, 0, 1}, {100, 0, 0, 0}, {500, 0, 0, 1}, {550, 0, 0, 0}},
+			[]Event{{Kind: Tap, Keys: []Key{a}}, {Kind: Tap, Keys: []Key{a}}},
+		},
+		{
+			"long press",
+			[]step{{0, 0, 0, 1}, {600, -1, 0, 0}, {800, 0, 0, 0}},
+			[]Event{
+				{Kind: LongPress, Keys: []Key{a}, Duration: 500 * time.Millisecond},
+				{Kind: HoldRelease, Keys: []Key{a}, Duration: 800 * time.Millisecond},
+			},
+		},
+		{
+			"long press noticed on release",
+			[]step{{0, 0, 0, 1}, {700, 0, 0, 0}},
+			[]Event{
+				{Kind: LongPress, Keys: []Key{a}, Duration: 500 * time.Millisecond},
+				{Kind: HoldRelease, Keys: []Key{a}, Duration: 700 * time.Millisecond},
+			},
+		},
+		{
+			"range",
+			[]step{{0, 0, 0, 1}, {200, 1, 0, 1}, {300, 1, 0, 0}, {400, 0, 0, 0}},
+			[]Event{{Kind: Range, Keys: []Key{a, b}}},
+		},
+		{
+			"chord",
+			[]step{{0, 1, 0, 1}, {10, 0, 0, 1}, {40, 2, 0, 1}, {60, -1, 0, 0}, {900, 0, 0, 0}, {900, 1, 0, 0}, {900, 2, 0, 0}},
+			[]Event{{Kind: Chord, Keys: []Key{b, a, c}}},
+		},
+		{
+			"chord released within the window",
+			[]step{{0, 0, 0, 1}, {10, 1, 0, 1}, {20, 0, 0, 0}, {30, 1, 0, 0}, {100, 2, 0, 1}, {150, 2, 0, 0}},
+			[]Event{{Kind: Chord, Keys: []Key{a, b}}, {Kind: Tap, Keys: []Key{c}}},
+		},
+	} {
+		start := time.Now()
+		s := &state{r: r, held: make(map[Key]*press), taps: make(map[Key]time.Time)}
+		for _, st := range test.steps {
+			at := start.Add(time.Duration(st.ms) * time.Millisecond)
+			if st.x < 0 {
+				s.expire(at)
+				continue
+			}
+			s.key(monome.KeyEvent{X: st.x, Y: st.y, State: st.state, Time: at})
+		}
+		for i := range s.out {
+			s.out[i].Time = time.Time{}
+		}
+		if !reflect.DeepEqual(s.out, test.want) {
+			t.Errorf("%s: got %+v, want %+v", test.name, s.out, test.want)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	r := &Recognizer{LongPress: 20 * time.Millisecond}
+	keys := make(chan monome.KeyEvent)
+	gestures := make(chan Event, 10)
+	done := make(chan error, 1)
+	go func() {
+		done <- r.Run(context.Background(), keys, gestures)
+	}()
+
+	keys <- monome.KeyEvent{X: 3, Y: 4, State: 1}
+	select {
+	case e := <-gestures:
+		if e.Kind != LongPress || !reflect.DeepEqual(e.Keys, []Key{{3, 4}}) {
+			t.Errorf("got %+v, want a long press of (3, 4)", e)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for a long press")
+	}
+	keys <- monome.KeyEvent{X: 3, Y: 4, State: 0}
+	select {
+	case e := <-gestures:
+		if e.Kind != HoldRelease || e.Duration < 20*time.Millisecond {
+			t.Errorf("got %+v, want a hold and release of at least 20ms", e)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for a hold and release")
+	}
+
+	close(keys)
+	if err := <-done; err != nil {
+		t.Errorf("got error %v when keys was closed", err)
+	}
+}
@@ -2,4 +2,4 @@ module github.com/kisielk/monome
 
 go 1.17
 
-require github.com/kisielk/go-osc v0.0.0-20150323163941-f2f83b76cb24 // indirect
+require github.com/kisielk/go-osc v0.0.0-20150323163941-f2f83b76cb24
@@ -0,0 +1,65 @@
+package monome
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+// LevelPalette holds the gray of each of the 16 LED levels, from off to fully lit.
+// It is the color model of an LEDBuffer used as an image.
+var LevelPalette = func() color.Palette {
+	p := make(color.Palette, 16)
+	for level := range p {
+		p[level] = color.Gray{Y: uint8(level * 17)}
+	}
+	return p
+}()
+
+// ColorModel returns LevelPalette. With Bounds, At and Set it makes an LEDBuffer
+// a draw.Image, so it can be encoded as a PNG or drawn with the image/draw package.
+func (b *LEDBuffer) ColorModel() color.Model {
+	return LevelPalette
+}
+
+// Bounds returns the rectangle from (0, 0) to (width, height).
+func (b *LEDBuffer) Bounds() image.Rectangle {
+	return image.Rect(0, 0, b.width, b.height)
+}
+
+// At returns the gray for the level of the LED at (x, y).
+func (b *LEDBuffer) At(x, y int) color.Color {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.inBounds(x, y) {
+		return LevelPalette[0]
+	}
+	return LevelPalette[clampLevel(b.Buf[x+y*b.width])]
+}
+
+// Set sets the LED at (x, y) to the level nearest to the brightness of c.
+func (b *LEDBuffer) Set(x, y int, c color.Color) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.setLevel(x, y, LevelPalette.Index(c))
+}
+
+// FromImage returns a buffer the size of img with the brightness of each pixel quantized
+// to the nearest level. If dither is set the quantization error is spread to neighboring
+// LEDs with Floyd-Steinberg dithering, which better preserves smooth gradients.
+func FromImage(img image.Image, dither bool) *LEDBuffer {
+	r := img.Bounds()
+	b := NewLEDBuffer(r.Dx(), r.Dy())
+	b.DrawImage(img, dither)
+	return b
+}
+
+// DrawImage draws img onto the buffer like FromImage, with the top left corner
+// of img at (0, 0). Parts of img outside of the buffer are clipped.
+func (b *LEDBuffer) DrawImage(img image.Image, dither bool) {
+	if dither {
+		draw.FloydSteinberg.Draw(b, b.Bounds(), img, img.Bounds().Min)
+		return
+	}
+	draw.Draw(b, b.Bounds(), img, img.Bounds().Min, draw.Src)
+}
@@ -0,0 +1,50 @@
+package monome
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"reflect"
+	"testing"
+)
+
+func TestPNGRoundTrip(t *testing.T) {
+	b := NewLEDBuffer(16, 8)
+	for i := range b.Buf {
+		b.Buf[i] = (i * 7) % 16
+	}
+	var buf bytes.Buffer
+	err := png.Encode(&buf, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := FromImage(img, false); !reflect.DeepEqual(got.Buf, b.Buf) {
+		t.Errorf("got %v, want %v", got.Buf, b.Buf)
+	}
+}
+
+func TestFromImageDither(t *testing.T) {
+	// A gray halfway between levels 7 and 8.
+	src := image.NewGray(image.Rect(10, 10, 18, 18))
+	for i := range src.Pix {
+		src.Pix[i] = 127
+	}
+
+	count := func(b *LEDBuffer) map[int]int {
+		n := make(map[int]int)
+		for _, level := range b.Buf {
+			n[level]++
+		}
+		return n
+	}
+	if got := count(FromImage(src, false)); !reflect.DeepEqual(got, map[int]int{7: 64}) {
+		t.Errorf("without dithering got levels %v, want all 7", got)
+	}
+	if got := count(FromImage(src, true)); got[7] == 0 || got[8] == 0 || got[7]+got[8] != 64 {
+		t.Errorf("with dithering got levels %v, want a mix of 7 and 8", got)
+	}
+}
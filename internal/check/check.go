@@ -0,0 +1,65 @@
+// Package check validates the arguments of LED methods for the grid backends,
+// so that they all return the same errors.
+package check
+
+import (
+	"errors"
+	"fmt"
+)
+
+// The errors returned by the checks, exported by package monome.
+var (
+	ErrOutOfBounds  = errors.New("coordinates out of bounds")
+	ErrInvalidLevel = errors.New("invalid level")
+)
+
+// Bounds is the size that LED coordinates are checked against.
+type Bounds struct {
+	Width, Height int
+	Unknown       bool // the size is not known yet, and nothing is checked
+}
+
+// Point checks that (x, y) is inside the bounds.
+func (b Bounds) Point(x, y int) error {
+	if b.Unknown {
+		return nil
+	}
+	if x < 0 || y < 0 || x >= b.Width || y >= b.Height {
+		return fmt.Errorf("%w: (%d, %d) on a %dx%d grid", ErrOutOfBounds, x, y, b.Width, b.Height)
+	}
+	return nil
+}
+
+// Run checks that n LEDs starting at (x, y) and advancing by (dx, dy) are inside the bounds.
+func (b Bounds) Run(x, y, dx, dy, n int) error {
+	err := b.Point(x, y)
+	if err == nil && n > 1 {
+		err = b.Point(x+(n-1)*dx, y+(n-1)*dy)
+	}
+	return err
+}
+
+// Bits checks a run of bitmasks starting at (x, y) and advancing by (dx, dy).
+// Each byte covers 8 LEDs, and only its first LED needs to be inside the bounds
+// so that bitmasks can be written to grids and buffers which are not a multiple of 8 wide.
+func (b Bounds) Bits(x, y, dx, dy int, states []byte) error {
+	return b.Run(x, y, 8*dx, 8*dy, len(states))
+}
+
+// State checks that state is 0 or 1.
+func State(state int) error {
+	if state != 0 && state != 1 {
+		return fmt.Errorf("%w: state %d is not 0 or 1", ErrInvalidLevel, state)
+	}
+	return nil
+}
+
+// Levels checks that every level is in the range [0, 15].
+func Levels(levels ...int) error {
+	for _, level := range levels {
+		if level < 0 || level > 15 {
+			return fmt.Errorf("%w: %d is not in [0, 15]", ErrInvalidLevel, level)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package monome
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// KeyState tracks which keys of a grid are held down. It is safe for concurrent use.
+// A Grid keeps one up to date from the keys it receives, see Grid.Keys, and one can
+// also be fed key events with Update.
+type KeyState struct {
+	mu      sync.RWMutex
+	down    map[[2]int]KeyEvent // the press event of each held key
+	presses map[[2]int]int      // the number of times each key has been pressed
+}
+
+// NewKeyState returns a KeyState with no keys held.
+func NewKeyState() *KeyState {
+	return &KeyState{
+		down:    make(map[[2]int]KeyEvent),
+		presses: make(map[[2]int]int),
+	}
+}
+
+// Update records a key event. Events with a zero Time are taken to have happened now.
+func (s *KeyState) Update(e KeyEvent) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	k := [2]int{e.X, e.Y}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e.State == 0 {
+		delete(s.down, k)
+		return
+	}
+	if _, ok := s.down[k]; ok {
+		return
+	}
+	s.down[k] = e
+	s.presses[k]++
+}
+
+// Reset releases all keys, such as when the device has been unplugged and the
+// releases of the keys held at the time will never arrive. The press counts are kept.
+func (s *KeyState) Reset() {
+	s.mu.Lock()
+	s.down = make(map[[2]int]KeyEvent)
+	s.mu.Unlock()
+}
+
+// IsDown reports whether the key at (x, y) is held.
+func (s *KeyState) IsDown(x, y int) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.down[[2]int{x, y}]
+	return ok
+}
+
+// DownKeys returns the press events of the held keys, in the order they were pressed.
+func (s *KeyState) DownKeys() []KeyEvent {
+	s.mu.RLock()
+	keys := make([]KeyEvent, 0, len(s.down))
+	for _, e := range s.down {
+		keys = append(keys, e)
+	}
+	s.mu.RUnlock()
+	sort.Slice(keys, func(i, j int) bool {
+		if !keys[i].Time.Equal(keys[j].Time) {
+			return keys[i].Time.Before(keys[j].Time)
+		}
+		return keys[i].Seq < keys[j].Seq
+	})
+	return keys
+}
+
+// Held returns how long the key at (x, y) has been held, or 0 if it is not held.
+func (s *KeyState) Held(x, y int) time.Duration {
+	s.mu.RLock()
+	e, ok := s.down[[2]int{x, y}]
+	s.mu.RUnlock()
+	if !ok {
+		return 0
+	}
+	return time.Since(e.Time)
+}
+
+// Presses returns the number of times the key at (x, y) has been pressed.
+func (s *KeyState) Presses(x, y int) int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.presses[[2]int{x, y}]
+}
+
+// Keys returns the state of the keys of the grid. It is updated before each key event
+// is delivered. All keys are released when the grid is closed, and when the device is
+// unplugged if EnableReconnect is used to watch for that.
+func (g *Grid) Keys() *KeyState {
+	return g.keys
+}
@@ -0,0 +1,42 @@
+package monome
+
+import (
+	"testing"
+	"time"
+)
+
+func TestKeyState(t *testing.T) {
+	s := NewKeyState()
+	start := time.Now().Add(-time.Second)
+	s.Update(KeyEvent{X: 2, Y: 1, State: 1, Time: start.Add(time.Millisecond)})
+	s.Update(KeyEvent{X: 0, Y: 3, State: 1, Time: start})
+	s.Update(KeyEvent{X: 2, Y: 1, State: 1, Time: start.Add(2 * time.Millisecond)})
+
+	if !s.IsDown(2, 1) || !s.IsDown(0, 3) || s.IsDown(1, 1) {
+		t.Errorf("got down (2, 1) %v, (0, 3) %v, (1, 1) %v, want true, true, false", s.IsDown(2, 1), s.IsDown(0, 3), s.IsDown(1, 1))
+	}
+	keys := s.DownKeys()
+	if len(keys) != 2 || keys[0].X != 0 || keys[1].X != 2 || !keys[1].Time.Equal(start.Add(time.Millisecond)) {
+		t.Errorf("got down keys %+v, want (0, 3) then (2, 1) from its first press", keys)
+	}
+	if d := s.Held(0, 3); d < time.Second {
+		t.Errorf("got (0, 3) held for %v, want at least 1s", d)
+	}
+	if s.Presses(2, 1) != 1 {
+		t.Errorf("got %d presses of (2, 1), want 1, a repeated press is not counted", s.Presses(2, 1))
+	}
+
+	s.Update(KeyEvent{X: 2, Y: 1, State: 0})
+	s.Update(KeyEvent{X: 2, Y: 1, State: 1})
+	if s.Presses(2, 1) != 2 || s.Held(2, 1) > time.Second {
+		t.Errorf("got %d presses of (2, 1) held for %v, want 2 held briefly", s.Presses(2, 1), s.Held(2, 1))
+	}
+
+	s.Reset()
+	if len(s.DownKeys()) != 0 || s.IsDown(0, 3) || s.Held(0, 3) != 0 {
+		t.Errorf("got down keys %+v after reset", s.DownKeys())
+	}
+	if s.Presses(2, 1) != 2 {
+		t.Errorf("got %d presses of (2, 1) after reset, want 2", s.Presses(2, 1))
+	}
+}
@@ -0,0 +1,173 @@
+package monome
+
+import (
+	"math"
+	"sort"
+	"sync"
+)
+
+// BlendMode controls how a Layer is combined with the layers below it.
+type BlendMode int
+
+const (
+	// BlendMax keeps the brighter of the layer and the layers below.
+	BlendMax BlendMode = iota
+	// BlendAdd adds the layer to the layers below, clamping the result to 15.
+	BlendAdd
+	// BlendReplace replaces the layers below with the layer.
+	BlendReplace
+	// BlendMask dims the layers below by the layer: level 15 leaves them
+	// unchanged and level 0 turns them off.
+	BlendMask
+)
+
+// A Layer is an LEDBuffer drawn as part of a LayerStack.
+// Drawing is done with the LEDBuffer methods.
+type Layer struct {
+	*LEDBuffer
+	stack   *LayerStack
+	z       int
+	visible bool
+	opacity float64
+	blend   BlendMode
+}
+
+// SetZ sets the position of the layer in the stack. Layers with a higher z are drawn on top,
+// layers with the same z are drawn in the order they were added.
+func (l *Layer) SetZ(z int) {
+	l.stack.mu.Lock()
+	defer l.stack.mu.Unlock()
+	l.z = z
+	l.stack.sort()
+}
+
+// SetVisible shows or hides the layer.
+func (l *Layer) SetVisible(visible bool) {
+	l.stack.mu.Lock()
+	defer l.stack.mu.Unlock()
+	l.visible = visible
+}
+
+// SetOpacity sets the opacity of the layer, from 0 for fully transparent to 1 for fully opaque.
+func (l *Layer) SetOpacity(opacity float64) {
+	l.stack.mu.Lock()
+	defer l.stack.mu.Unlock()
+	l.opacity = math.Max(0, math.Min(1, opacity))
+}
+
+// SetBlend sets the way the layer is combined with the layers below it.
+func (l *Layer) SetBlend(mode BlendMode) {
+	l.stack.mu.Lock()
+	defer l.stack.mu.Unlock()
+	l.blend = mode
+}
+
+// LayerStack composites a stack of layers into the levels sent to a grid.
+type LayerStack struct {
+	width  int
+	height int
+	out    *LEDBuffer // the flattened stack, rendered to grids
+
+	mu     sync.Mutex // protects layers and their properties
+	layers []*Layer   // sorted by z
+}
+
+// NewLayerStack creates an empty stack of width by height layers.
+func NewLayerStack(width, height int) *LayerStack {
+	return &LayerStack{
+		width:  width,
+		height: height,
+		out:    NewLEDBuffer(width, height),
+	}
+}
+
+// AddLayer adds a visible, fully opaque layer at position z using the given blend mode.
+func (s *LayerStack) AddLayer(z int, mode BlendMode) *Layer {
+	l := &Layer{
+		LEDBuffer: NewLEDBuffer(s.width, s.height),
+		stack:     s,
+		z:         z,
+		visible:   true,
+		opacity:   1,
+		blend:     mode,
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.layers = append(s.layers, l)
+	s.sort()
+	return l
+}
+
+// RemoveLayer removes a layer from the stack.
+func (s *LayerStack) RemoveLayer(l *Layer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, layer := range s.layers {
+		if layer == l {
+			s.layers = append(s.layers[:i], s.layers[i+1:]...)
+			return
+		}
+	}
+}
+
+// sort orders the layers by z. It must be called with s.mu held.
+func (s *LayerStack) sort() {
+	sort.SliceStable(s.layers, func(i, j int) bool {
+		return s.layers[i].z < s.layers[j].z
+	})
+}
+
+// Flatten composites the visible layers from the bottom up, starting with all LEDs off,
+// and returns the resulting levels in the same layout as LEDBuffer.Buf.
+func (s *LayerStack) Flatten() []int {
+	out := make([]int, s.width*s.height)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, l := range s.layers {
+		if !l.visible {
+			continue
+		}
+		for i, level := range l.Snapshot() {
+			out[i] = blend(l.blend, out[i], clampLevel(level), l.opacity)
+		}
+	}
+	return out
+}
+
+// Render flattens the stack and renders the result to w like LEDBuffer.Render,
+// only sending the LEDs that changed since the last render to w.
+func (s *LayerStack) Render(w LevelWriter) error {
+	s.out.Swap(s.Flatten())
+	return s.out.Render(w)
+}
+
+// blend combines level from a layer with the given opacity into dst.
+func blend(mode BlendMode, dst, level int, opacity float64) int {
+	src := int(math.Round(float64(level) * opacity))
+	switch mode {
+	case BlendMax:
+		if src > dst {
+			return src
+		}
+		return dst
+	case BlendAdd:
+		return clampLevel(dst + src)
+	case BlendReplace:
+		return int(math.Round(float64(dst) + float64(level-dst)*opacity))
+	case BlendMask:
+		factor := 1 - opacity*(1-float64(level)/15)
+		return int(math.Round(float64(dst) * factor))
+	}
+	return dst
+}
+
+// clampLevel limits level to the range [0, 15].
+func clampLevel(level int) int {
+	if level < 0 {
+		return 0
+	}
+	if level > 15 {
+		return 15
+	}
+	return level
+}
@@ -0,0 +1,78 @@
+package monome
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBlend(t *testing.T) {
+	tests := []struct {
+		mode    BlendMode
+		dst     int
+		level   int
+		opacity float64
+		want    int
+	}{
+		{BlendMax, 5, 10, 1, 10},
+		{BlendMax, 10, 5, 1, 10},
+		{BlendMax, 4, 10, 0.5, 5},
+		{BlendAdd, 10, 10, 1, 15},
+		{BlendAdd, 3, 4, 1, 7},
+		{BlendAdd, 3, 4, 0.5, 5},
+		{BlendReplace, 10, 0, 1, 0},
+		{BlendReplace, 10, 0, 0.5, 5},
+		{BlendReplace, 0, 12, 0.25, 3},
+		{BlendMask, 12, 15, 1, 12},
+		{BlendMask, 12, 0, 1, 0},
+		{BlendMask, 12, 5, 1, 4},
+		{BlendMask, 12, 0, 0.5, 6},
+		{BlendMask, 12, 0, 0, 12},
+	}
+	for _, test := range tests {
+		got := blend(test.mode, test.dst, test.level, test.opacity)
+		if got != test.want {
+			t.Errorf("blend(%d, %d, %d, %g) = %d, want %d",
+				test.mode, test.dst, test.level, test.opacity, got, test.want)
+		}
+	}
+}
+
+func TestLayerStack(t *testing.T) {
+	s := NewLayerStack(8, 1)
+	overlay := s.AddLayer(2, BlendReplace)
+	background := s.AddLayer(0, BlendMax)
+	playhead := s.AddLayer(1, BlendAdd)
+
+	background.LEDLevelRow(0, 0, []int{4, 4, 4, 4, 4, 4, 4, 4})
+	playhead.LEDLevelSet(2, 0, 15)
+	overlay.LEDLevelSet(5, 0, 1)
+	overlay.SetOpacity(0.5)
+
+	want := []int{2, 2, 8, 2, 2, 3, 2, 2}
+	if got := s.Flatten(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	overlay.SetVisible(false)
+	playhead.SetZ(-1) // now below the background
+	want = []int{4, 4, 15, 4, 4, 4, 4, 4}
+	if got := s.Flatten(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	dst := NewLEDBuffer(8, 8)
+	s = NewLayerStack(8, 8)
+	l := s.AddLayer(0, BlendMax)
+	for i := range l.Buf {
+		l.Buf[i] = 20 // out of range levels written directly to Buf are clamped
+	}
+	err := s.Render(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, level := range dst.Buf {
+		if level != 15 {
+			t.Fatalf("got level %d, want 15", level)
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package monome
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// A ManagerEvent is sent by a DeviceManager when a grid is attached or detached.
+// It is an AttachEvent, a DetachEvent or an ErrorEvent.
+type ManagerEvent interface {
+	managerEvent()
+}
+
+// An AttachEvent is sent when a DeviceManager has opened a newly connected grid
+// and the grid has replied with its id, size and rotation.
+type AttachEvent struct {
+	Device DeviceEvent
+	Grid   *Grid
+}
+
+// A DetachEvent is sent when a grid is disconnected.
+// The Grid has already been closed when the event is received.
+type DetachEvent struct {
+	Device DeviceEvent
+	Grid   *Grid
+}
+
+// An ErrorEvent is sent when a newly connected grid could not be opened,
+// such as when it didn't reply within ConnectTimeout. The grid is not retried
+// until serialosc reports it as connected again.
+type ErrorEvent struct {
+	Device DeviceEvent
+	Err    error
+}
+
+func (AttachEvent) managerEvent() {}
+func (DetachEvent) managerEvent() {}
+func (ErrorEvent) managerEvent()  {}
+
+// DeviceManager keeps track of the grids known to serialosc for the lifetime of the process.
+// A Grid is opened for every device that is connected and closed when the device goes away.
+// Arcs are ignored.
+type DeviceManager struct {
+	so           *SerialOsc
+	host         string
+	prefix       string
+	keyEvents    chan KeyEvent
+	events       chan ManagerEvent
+	deviceEvents chan DeviceEvent
+
+	mu      sync.Mutex
+	grids   map[string]*Grid
+	dialing map[string]*dial // the grids being opened, by id
+	dials   sync.WaitGroup
+
+	closeOnce sync.Once
+	done      chan struct{}
+	stopped   chan struct{}
+}
+
+// NewDeviceManager creates a DeviceManager using the serialosc instance at the given address.
+// If an empty address is given it defaults to localhost:12002.
+// Every grid is opened with the given prefix and sends its KeyEvents to keyEvents.
+// Attach, detach and error events are sent to the events channel, which must be serviced
+// for the manager to make progress.
+func NewDeviceManager(address, prefix string, keyEvents chan KeyEvent, events chan ManagerEvent) (*DeviceManager, error) {
+	deviceEvents := make(chan DeviceEvent, 16)
+	so, err := DialSerialOsc(address, deviceEvents)
+	if err != nil {
+		return nil, err
+	}
+	m := &DeviceManager{
+		so:           so,
+		host:         so.c.IP(),
+		prefix:       prefix,
+		keyEvents:    keyEvents,
+		events:       events,
+		deviceEvents: deviceEvents,
+		grids:        make(map[string]*Grid),
+		dialing:      make(map[string]*dial),
+		done:         make(chan struct{}),
+		stopped:      make(chan struct{}),
+	}
+	err = so.Notify()
+	if err != nil {
+		so.Close()
+		return nil, err
+	}
+	err = so.List()
+	if err != nil {
+		so.Close()
+		return nil, err
+	}
+	go m.run()
+	return m, nil
+}
+
+// Grid returns the grid with the given id, or nil if it is not connected.
+func (m *DeviceManager) Grid(id string) *Grid {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.grids[id]
+}
+
+// Grids returns all the currently connected grids by id.
+func (m *DeviceManager) Grids() map[string]*Grid {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	grids := make(map[string]*Grid, len(m.grids))
+	for id, g := range m.grids {
+		grids[id] = g
+	}
+	return grids
+}
+
+// Close stops tracking devices and closes the connection to serialosc and all the managed grids.
+func (m *DeviceManager) Close() error {
+	var err error
+	m.closeOnce.Do(func() {
+		close(m.done)
+		err = m.so.Close()
+		<-m.stopped
+		m.mu.Lock()
+		for id, d := range m.dialing {
+			d.cancel()
+			delete(m.dialing, id)
+		}
+		m.mu.Unlock()
+		m.dials.Wait()
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		for id, g := range m.grids {
+			g.Close()
+			delete(m.grids, id)
+		}
+	})
+	return err
+}
+
+func (m *DeviceManager) run() {
+	defer close(m.stopped)
+	watchDevices(m.so, m.deviceEvents, m.done, m.handleDeviceEvent)
+}
+
+func (m *DeviceManager) handleDeviceEvent(ev DeviceEvent) {
+	if ev.Removed {
+		m.detach(ev)
+	} else {
+		m.attach(ev)
+	}
+}
+
+// watchDevices calls f for every event received from so until done is closed.
+// Notifications are requested again after every notification received.
+func watchDevices(so *SerialOsc, events chan DeviceEvent, done chan struct{}, f func(DeviceEvent)) {
+	for {
+		select {
+		case ev := <-events:
+			if ev.notification {
+				so.Notify()
+			}
+			f(ev)
+		case <-done:
+			return
+		}
+	}
+}
+
+// A dial is a grid being opened.
+type dial struct {
+	cancel context.CancelFunc
+}
+
+// attach starts opening a newly connected grid. The grid is opened in its own goroutine,
+// so that waiting for its replies doesn't hold up the events for other devices.
+func (m *DeviceManager) attach(ev DeviceEvent) {
+	if strings.Contains(ev.Type, "arc") {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.grids[ev.Id] != nil || m.dialing[ev.Id] != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), ConnectTimeout)
+	d := &dial{cancel}
+	m.dialing[ev.Id] = d
+	m.dials.Add(1)
+	go m.dial(ctx, d, ev)
+}
+
+// dial opens the grid for ev and sends an AttachEvent or ErrorEvent, unless the grid
+// was disconnected or the manager closed in the meantime.
+func (m *DeviceManager) dial(ctx context.Context, d *dial, ev DeviceEvent) {
+	defer m.dials.Done()
+	defer d.cancel()
+	g, err := DialGridContext(ctx, net.JoinHostPort(m.host, strconv.Itoa(ev.Port)), m.prefix, m.keyEvents)
+	m.mu.Lock()
+	current := m.dialing[ev.Id] == d
+	if current {
+		delete(m.dialing, ev.Id)
+		if err == nil {
+			m.grids[ev.Id] = g
+		}
+	}
+	m.mu.Unlock()
+	switch {
+	case !current:
+		if err == nil {
+			g.Close()
+		}
+	case err != nil:
+		m.send(ErrorEvent{Device: ev, Err: err})
+	default:
+		m.send(AttachEvent{Device: ev, Grid: g})
+	}
+}
+
+func (m *DeviceManager) detach(ev DeviceEvent) {
+	m.mu.Lock()
+	if d := m.dialing[ev.Id]; d != nil {
+		d.cancel()
+		delete(m.dialing, ev.Id)
+	}
+	g, ok := m.grids[ev.Id]
+	delete(m.grids, ev.Id)
+	m.mu.Unlock()
+	if !ok {
+		return
+	}
+	g.Close()
+	m.send(DetachEvent{Device: ev, Grid: g})
+}
+
+func (m *DeviceManager) send(ev ManagerEvent) {
+	select {
+	case m.events <- ev:
+	case <-m.done:
+	}
+}
@@ -0,0 +1,483 @@
+// Package mext talks to monome grids directly over a serial port using the
+// binary "mext" protocol, without the serialosc daemon.
+//
+// The Grid type has the same LED methods as monome.Grid and delivers the
+// same event types, so application code works with either backend.
+// Devices sending messages from sections of the protocol other than system,
+// grid keys, encoders and tilt are not supported.
+package mext
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kisielk/monome"
+	"github.com/kisielk/monome/internal/check"
+)
+
+// Message headers sent by the host.
+const (
+	cmdQuery        = 0x00
+	cmdGetId        = 0x01
+	cmdGetSize      = 0x05
+	cmdLEDOff       = 0x10
+	cmdLEDOn        = 0x11
+	cmdLEDAllOff    = 0x12
+	cmdLEDAllOn     = 0x13
+	cmdLEDMap       = 0x14
+	cmdLEDRow       = 0x15
+	cmdLEDCol       = 0x16
+	cmdLEDIntensity = 0x17
+	cmdLevelSet     = 0x18
+	cmdLevelAll     = 0x19
+	cmdLevelMap     = 0x1a
+	cmdLevelRow     = 0x1b
+	cmdLevelCol     = 0x1c
+	cmdTiltEnable   = 0x82
+	cmdTiltDisable  = 0x83
+)
+
+// Message headers sent by the device.
+const (
+	evQuery      = 0x00
+	evId         = 0x01
+	evOffset     = 0x02
+	evSize       = 0x03
+	evAddr       = 0x04
+	evVersion    = 0x0f
+	evKeyUp      = 0x20
+	evKeyDown    = 0x21
+	evEncDelta   = 0x50
+	evEncKeyUp   = 0x51
+	evEncKeyDown = 0x52
+	evTiltActive = 0x80
+	evTilt       = 0x81
+)
+
+// payloadSizes holds the number of bytes following each header sent by the device.
+// Only the system, grid key, encoder and tilt sections of the protocol are supported.
+var payloadSizes = map[byte]int{
+	evQuery:      2,
+	evId:         32,
+	evOffset:     2,
+	evSize:       2,
+	evAddr:       2,
+	evVersion:    8,
+	evKeyUp:      2,
+	evKeyDown:    2,
+	evEncDelta:   2,
+	evEncKeyUp:   1,
+	evEncKeyDown: 1,
+	evTiltActive: 1,
+	evTilt:       7,
+}
+
+var (
+	_ monome.LEDWriter   = (*Grid)(nil)
+	_ monome.LevelWriter = (*Grid)(nil)
+)
+
+// Grid is a monome device connected over a serial port.
+type Grid struct {
+	rw     io.ReadWriter
+	events chan monome.KeyEvent
+
+	wmu sync.Mutex // serializes writes to rw
+
+	mu      sync.RWMutex
+	id      string
+	width   int
+	height  int
+	tilt    chan monome.TiltEvent
+	deltas  chan monome.EncDeltaEvent
+	encKeys chan monome.EncKeyEvent
+	updated chan struct{} // closed and replaced when the id or size is received
+	keySeq  uint64        // the sequence number of the last key event
+}
+
+// Open opens the serial port with the given name, such as /dev/ttyUSB0, and
+// connects to the grid on it. The port must already be configured for raw
+// 8N1 communication, for example with "stty -F /dev/ttyUSB0 raw 115200".
+func Open(name string, events chan monome.KeyEvent) (*Grid, error) {
+	f, err := os.OpenFile(name, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	g, err := New(f, events)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return g, nil
+}
+
+// New connects to a grid speaking the mext protocol over rw.
+// KeyEvents which are received will be sent in to the given events channel,
+// which may be nil, in which case they are discarded.
+// The id and size of the grid are requested but not waited for, see NewContext.
+// If rw is an io.Closer it is closed by Close, and by New if the requests can't be sent.
+// Otherwise reading from rw carries on after such a failure until a read fails.
+func New(rw io.ReadWriter, events chan monome.KeyEvent) (*Grid, error) {
+	g := &Grid{
+		rw:      rw,
+		events:  events,
+		updated: make(chan struct{}),
+	}
+	// Reading starts before the queries are sent, so that a device answering each
+	// of them straight away over an unbuffered connection isn't left waiting.
+	go g.read()
+	for _, cmd := range []byte{cmdQuery, cmdGetId, cmdGetSize} {
+		err := g.write(cmd)
+		if err != nil {
+			g.Close()
+			return nil, err
+		}
+	}
+	return g, nil
+}
+
+// NewContext is like New but waits until the grid has replied with its id and size.
+func NewContext(ctx context.Context, rw io.ReadWriter, events chan monome.KeyEvent) (*Grid, error) {
+	g, err := New(rw, events)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		g.mu.RLock()
+		ready := g.id != "" && g.width != 0
+		updated := g.updated
+		g.mu.RUnlock()
+		if ready {
+			return g, nil
+		}
+		select {
+		case <-updated:
+		case <-ctx.Done():
+			g.Close()
+			return nil, fmt.Errorf("no id or size from grid: %w", ctx.Err())
+		}
+	}
+}
+
+// Close closes the underlying connection if it is an io.Closer.
+func (g *Grid) Close() error {
+	if c, ok := g.rw.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// Id returns the id of the connected grid.
+func (g *Grid) Id() string {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.id
+}
+
+// Width returns the width of the connected grid.
+func (g *Grid) Width() int {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.width
+}
+
+// Height returns the height of the connected grid.
+func (g *Grid) Height() int {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.height
+}
+
+// SetTiltEvents sets the channel that TiltEvents are sent to.
+// Tilt data is discarded while the channel is nil, which is the default.
+func (g *Grid) SetTiltEvents(events chan monome.TiltEvent) {
+	g.mu.Lock()
+	g.tilt = events
+	g.mu.Unlock()
+}
+
+// SetEncEvents sets the channels that encoder deltas and key presses are sent to,
+// for devices with encoders. Events are discarded while a channel is nil, which is the default.
+func (g *Grid) SetEncEvents(deltas chan monome.EncDeltaEvent, keys chan monome.EncKeyEvent) {
+	g.mu.Lock()
+	g.deltas = deltas
+	g.encKeys = keys
+	g.mu.Unlock()
+}
+
+// read decodes messages from the device until reading fails.
+//
+// The length of a message is only known from its header, so a header missing from
+// payloadSizes, such as one from the unsupported digital or analog sections, is skipped
+// on its own and its payload bytes are then read as headers. Resynchronizing is therefore
+// best-effort: those bytes may be taken for further messages, including key or tilt events.
+func (g *Grid) read() {
+	r := bufio.NewReader(g.rw)
+	for {
+		header, err := r.ReadByte()
+		if err != nil {
+			return
+		}
+		n, ok := payloadSizes[header]
+		if !ok {
+			// Unknown header, skip it and hope the next byte starts a message.
+			continue
+		}
+		payload := make([]byte, n)
+		_, err = io.ReadFull(r, payload)
+		if err != nil {
+			return
+		}
+		g.handle(header, payload)
+	}
+}
+
+func (g *Grid) handle(header byte, p []byte) {
+	switch header {
+	case evId:
+		g.mu.Lock()
+		g.id = strings.TrimRight(string(p), "\x00")
+		close(g.updated)
+		g.updated = make(chan struct{})
+		g.mu.Unlock()
+	case evSize:
+		g.mu.Lock()
+		g.width = int(p[0])
+		g.height = int(p[1])
+		close(g.updated)
+		g.updated = make(chan struct{})
+		g.mu.Unlock()
+	case evKeyUp, evKeyDown:
+		now := time.Now()
+		g.mu.Lock()
+		g.keySeq++
+		e := monome.KeyEvent{X: int(p[0]), Y: int(p[1]), State: int(header - evKeyUp), Time: now, Seq: g.keySeq, Device: g.id}
+		g.mu.Unlock()
+		if g.events != nil {
+			g.events <- e
+		}
+	case evEncDelta:
+		g.mu.RLock()
+		deltas := g.deltas
+		g.mu.RUnlock()
+		if deltas != nil {
+			deltas <- monome.EncDeltaEvent{N: int(p[0]), Delta: int(int8(p[1]))}
+		}
+	case evEncKeyUp, evEncKeyDown:
+		g.mu.RLock()
+		keys := g.encKeys
+		g.mu.RUnlock()
+		if keys != nil {
+			keys <- monome.EncKeyEvent{N: int(p[0]), State: int(header - evEncKeyUp)}
+		}
+	case evTilt:
+		g.mu.RLock()
+		tilt := g.tilt
+		g.mu.RUnlock()
+		if tilt != nil {
+			tilt <- monome.TiltEvent{
+				N: int(p[0]),
+				X: int(int16(uint16(p[1])<<8 | uint16(p[2]))),
+				Y: int(int16(uint16(p[3])<<8 | uint16(p[4]))),
+				Z: int(int16(uint16(p[5])<<8 | uint16(p[6]))),
+			}
+		}
+	}
+}
+
+// write sends a single message to the device.
+func (g *Grid) write(header byte, payload ...byte) error {
+	g.wmu.Lock()
+	defer g.wmu.Unlock()
+	_, err := g.rw.Write(append([]byte{header}, payload...))
+	return err
+}
+
+// bounds returns the size of the grid for checking coordinates. Until the grid has
+// replied with its size, coordinates are only checked to fit in a message byte.
+func (g *Grid) bounds() check.Bounds {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	if g.width == 0 || g.height == 0 {
+		return check.Bounds{Width: 256, Height: 256}
+	}
+	return check.Bounds{Width: g.width, Height: g.height}
+}
+
+// packLevels packs pairs of levels into single bytes, the first level in the high nibble.
+func packLevels(levels []int) []byte {
+	b := make([]byte, (len(levels)+1)/2)
+	for i, level := range levels {
+		b[i/2] |= byte(level&0xf) << uint(4*(1-i%2))
+	}
+	return b
+}
+
+// LEDSet sets the LED at (x, y) to the given state.
+// State must be 1 for on or 0 for off.
+func (g *Grid) LEDSet(x, y, state int) error {
+	if err := g.bounds().Point(x, y); err != nil {
+		return err
+	}
+	if err := check.State(state); err != nil {
+		return err
+	}
+	if state == 0 {
+		return g.write(cmdLEDOff, byte(x), byte(y))
+	}
+	return g.write(cmdLEDOn, byte(x), byte(y))
+}
+
+// LEDAll sets all LEDs to the given state.
+// State must be 1 for on or 0 for off.
+func (g *Grid) LEDAll(state int) error {
+	if err := check.State(state); err != nil {
+		return err
+	}
+	if state == 0 {
+		return g.write(cmdLEDAllOff)
+	}
+	return g.write(cmdLEDAllOn)
+}
+
+// LEDMap sets an 8x8 grid of LEDs to the given states, one bitmask per row.
+// xOffset and yOffset must be multiples of 8.
+func (g *Grid) LEDMap(xOffset, yOffset int, states [8]byte) error {
+	if err := g.bounds().Point(xOffset, yOffset); err != nil {
+		return err
+	}
+	return g.write(cmdLEDMap, append([]byte{byte(xOffset), byte(yOffset)}, states[:]...)...)
+}
+
+// LEDRow sets the LEDs in row y starting at xOffset from the bitmasks in states,
+// each byte covering 8 LEDs.
+func (g *Grid) LEDRow(xOffset, y int, states ...byte) error {
+	if err := g.bounds().Bits(xOffset, y, 1, 0, states); err != nil {
+		return err
+	}
+	for i, s := range states {
+		err := g.write(cmdLEDRow, byte(xOffset+i*8), byte(y), s)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LEDCol sets the LEDs in column x starting at yOffset from the bitmasks in states,
+// each byte covering 8 LEDs.
+func (g *Grid) LEDCol(x, yOffset int, states ...byte) error {
+	if err := g.bounds().Bits(x, yOffset, 0, 1, states); err != nil {
+		return err
+	}
+	for i, s := range states {
+		err := g.write(cmdLEDCol, byte(x), byte(yOffset+i*8), s)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LEDIntensity sets the intensity of the grid LEDs. The value of i must be in the range [0, 15].
+func (g *Grid) LEDIntensity(i int) error {
+	if err := check.Levels(i); err != nil {
+		return err
+	}
+	return g.write(cmdLEDIntensity, byte(i))
+}
+
+// LEDLevelSet sets the level of the LED at coordinates x, y. The value of level must be in the range [0, 15].
+func (g *Grid) LEDLevelSet(x, y, level int) error {
+	if err := g.bounds().Point(x, y); err != nil {
+		return err
+	}
+	if err := check.Levels(level); err != nil {
+		return err
+	}
+	return g.write(cmdLevelSet, byte(x), byte(y), byte(level))
+}
+
+// LEDLevelAll sets the level of all LEDs.
+func (g *Grid) LEDLevelAll(level int) error {
+	if err := check.Levels(level); err != nil {
+		return err
+	}
+	return g.write(cmdLevelAll, byte(level))
+}
+
+// LEDLevelMap is like LEDMap but with control over the level.
+func (g *Grid) LEDLevelMap(xOffset, yOffset int, levels [64]int) error {
+	if err := g.bounds().Point(xOffset, yOffset); err != nil {
+		return err
+	}
+	if err := check.Levels(levels[:]...); err != nil {
+		return err
+	}
+	return g.write(cmdLevelMap, append([]byte{byte(xOffset), byte(yOffset)}, packLevels(levels[:])...)...)
+}
+
+// LEDLevelRow is like LEDRow but with control over the level.
+func (g *Grid) LEDLevelRow(xOffset, y int, levels []int) error {
+	if err := g.bounds().Run(xOffset, y, 1, 0, len(levels)); err != nil {
+		return err
+	}
+	if err := check.Levels(levels...); err != nil {
+		return err
+	}
+	return g.levelLine(cmdLevelRow, xOffset, y, 1, 0, levels)
+}
+
+// LEDLevelCol is like LEDCol but with control over the level.
+func (g *Grid) LEDLevelCol(x, yOffset int, levels []int) error {
+	if err := g.bounds().Run(x, yOffset, 0, 1, len(levels)); err != nil {
+		return err
+	}
+	if err := check.Levels(levels...); err != nil {
+		return err
+	}
+	return g.levelLine(cmdLevelCol, x, yOffset, 0, 1, levels)
+}
+
+// levelLine sends checked levels starting at (x, y) in runs of 8 along (dx, dy).
+// A trailing run shorter than 8 is sent as individual LEDs so its neighbours are left alone.
+func (g *Grid) levelLine(cmd byte, x, y, dx, dy int, levels []int) error {
+	for i := 0; i < len(levels); i += 8 {
+		run := levels[i:]
+		if len(run) < 8 {
+			for j, level := range run {
+				err := g.write(cmdLevelSet, byte(x+(i+j)*dx), byte(y+(i+j)*dy), byte(level))
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		err := g.write(cmd, append([]byte{byte(x + i*dx), byte(y + i*dy)}, packLevels(run[:8])...)...)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TiltSet enables or disables tilt sensor n.
+// State must be 1 for on or 0 for off.
+func (g *Grid) TiltSet(n, state int) error {
+	if n < 0 || n > 255 {
+		return fmt.Errorf("%w: tilt sensor %d does not fit in a message", monome.ErrOutOfBounds, n)
+	}
+	if err := check.State(state); err != nil {
+		return err
+	}
+	if state == 0 {
+		return g.write(cmdTiltDisable, byte(n))
+	}
+	return g.write(cmdTiltEnable, byte(n))
+}
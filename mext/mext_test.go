@@ -0,0 +1,268 @@
+package mext
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/kisielk/monome"
+)
+
+// recorder is a connection that never sends anything and records what is written to it.
+type recorder struct {
+	io.Reader
+	out bytes.Buffer
+}
+
+func (r *recorder) Write(p []byte) (int, error) {
+	return r.out.Write(p)
+}
+
+func newRecorder(t *testing.T) *recorder {
+	r, w := io.Pipe()
+	t.Cleanup(func() { w.Close() })
+	return &recorder{Reader: r}
+}
+
+func TestEncode(t *testing.T) {
+	levels := [64]int{}
+	for i := range levels {
+		levels[i] = i % 16
+	}
+	tests := []struct {
+		name string
+		f    func(g *Grid) error
+		want []byte
+	}{
+		{"LEDSet on", func(g *Grid) error { return g.LEDSet(1, 2, 1) }, []byte{0x11, 1, 2}},
+		{"LEDSet off", func(g *Grid) error { return g.LEDSet(1, 2, 0) }, []byte{0x10, 1, 2}},
+		{"LEDAll", func(g *Grid) error { return g.LEDAll(1) }, []byte{0x13}},
+		{"LEDMap", func(g *Grid) error { return g.LEDMap(8, 0, [8]byte{1, 2, 3, 4, 5, 6, 7, 8}) },
+			[]byte{0x14, 8, 0, 1, 2, 3, 4, 5, 6, 7, 8}},
+		{"LEDRow", func(g *Grid) error { return g.LEDRow(0, 3, 0xaa, 0x55) },
+			[]byte{0x15, 0, 3, 0xaa, 0x15, 8, 3, 0x55}},
+		{"LEDCol", func(g *Grid) error { return g.LEDCol(5, 0, 0x0f) }, []byte{0x16, 5, 0, 0x0f}},
+		{"LEDIntensity", func(g *Grid) error { return g.LEDIntensity(7) }, []byte{0x17, 7}},
+		{"LEDLevelSet", func(g *Grid) error { return g.LEDLevelSet(3, 4, 9) }, []byte{0x18, 3, 4, 9}},
+		{"LEDLevelAll", func(g *Grid) error { return g.LEDLevelAll(4) }, []byte{0x19, 4}},
+		{"LEDLevelMap", func(g *Grid) error { return g.LEDLevelMap(0, 8, levels) },
+			append([]byte{0x1a, 0, 8}, bytes.Repeat([]byte{0x01, 0x23, 0x45, 0x67, 0x89, 0xab, 0xcd, 0xef}, 4)...)},
+		{"LEDLevelRow", func(g *Grid) error { return g.LEDLevelRow(0, 1, []int{15, 14, 13, 12, 11, 10, 9, 8, 1, 2}) },
+			[]byte{0x1b, 0, 1, 0xfe, 0xdc, 0xba, 0x98, 0x18, 8, 1, 1, 0x18, 9, 1, 2}},
+		{"LEDLevelCol", func(g *Grid) error { return g.LEDLevelCol(2, 0, []int{0, 1, 2, 3, 4, 5, 6, 7}) },
+			[]byte{0x1c, 2, 0, 0x01, 0x23, 0x45, 0x67}},
+		{"TiltSet", func(g *Grid) error { return g.TiltSet(0, 1) }, []byte{0x82, 0}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := newRecorder(t)
+			g, err := New(r, make(chan monome.KeyEvent))
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Skip the queries sent by New.
+			r.out.Next(3)
+			err = test.f(g)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := r.out.Bytes(); !bytes.Equal(got, test.want) {
+				t.Errorf("got % x, want % x", got, test.want)
+			}
+		})
+	}
+}
+
+func TestEncodeOutOfRange(t *testing.T) {
+	g, err := New(newRecorder(t), make(chan monome.KeyEvent))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"LEDSet(-1, 0, 1)", g.LEDSet(-1, 0, 1), monome.ErrOutOfBounds},
+		{"LEDSet(0, 256, 1)", g.LEDSet(0, 256, 1), monome.ErrOutOfBounds},
+		{"LEDSet(0, 0, 2)", g.LEDSet(0, 0, 2), monome.ErrInvalidLevel},
+		{"LEDAll(-1)", g.LEDAll(-1), monome.ErrInvalidLevel},
+		{"TiltSet(0, 5)", g.TiltSet(0, 5), monome.ErrInvalidLevel},
+		{"LEDIntensity(16)", g.LEDIntensity(16), monome.ErrInvalidLevel},
+		{"LEDLevelSet(0, 0, 16)", g.LEDLevelSet(0, 0, 16), monome.ErrInvalidLevel},
+		{"LEDLevelAll(200)", g.LEDLevelAll(200), monome.ErrInvalidLevel},
+		{"LEDLevelRow(0, 0, 1, 16)", g.LEDLevelRow(0, 0, []int{1, 16}), monome.ErrInvalidLevel},
+		{"LEDLevelMap(0, 0, 255)", g.LEDLevelMap(0, 0, [64]int{63: 255}), monome.ErrInvalidLevel},
+	} {
+		if !errors.Is(test.err, test.want) {
+			t.Errorf("%s: got error %v, want %v", test.name, test.err, test.want)
+		}
+	}
+
+	// Once the size is known coordinates are checked against it.
+	g.handle(evSize, []byte{8, 8})
+	if err := g.LEDLevelRow(4, 0, make([]int, 8)); !errors.Is(err, monome.ErrOutOfBounds) {
+		t.Errorf("LEDLevelRow(4, 0) on an 8x8 grid: got error %v, want %v", err, monome.ErrOutOfBounds)
+	}
+}
+
+// failing is a connection that fails every write.
+type failing struct {
+	*io.PipeReader
+}
+
+func (failing) Write(p []byte) (int, error) {
+	return 0, io.ErrClosedPipe
+}
+
+func TestNewWriteError(t *testing.T) {
+	r, w := io.Pipe()
+	defer w.Close()
+	_, err := New(failing{r}, nil)
+	if err != io.ErrClosedPipe {
+		t.Errorf("got error %v, want %v", err, io.ErrClosedPipe)
+	}
+	// The connection is closed, which stops the reading from it.
+	if _, err := r.Read(make([]byte, 1)); err != io.ErrClosedPipe {
+		t.Errorf("got read error %v after New failed, want %v", err, io.ErrClosedPipe)
+	}
+}
+
+func TestNewImmediateReplies(t *testing.T) {
+	host, device := net.Pipe()
+	defer device.Close()
+
+	// The device replies to each query as soon as it is read, and net.Pipe
+	// has no buffering, so the replies must be read while the queries are sent.
+	go func() {
+		query := make([]byte, 1)
+		for {
+			_, err := device.Read(query)
+			if err != nil {
+				return
+			}
+			switch query[0] {
+			case cmdQuery:
+				device.Write([]byte{evQuery, 1, 1})
+			case cmdGetId:
+				id := make([]byte, 33)
+				id[0] = evId
+				copy(id[1:], "m1000002")
+				device.Write(id)
+			case cmdGetSize:
+				device.Write([]byte{evSize, 8, 8})
+			}
+		}
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	g, err := NewContext(ctx, host, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+	if g.Id() != "m1000002" || g.Width() != 8 || g.Height() != 8 {
+		t.Errorf("got id %q, size %dx%d", g.Id(), g.Width(), g.Height())
+	}
+}
+
+func TestDecodeNilKeyEvents(t *testing.T) {
+	host, device := net.Pipe()
+	defer device.Close()
+	go io.ReadFull(device, make([]byte, 3))
+	g, err := New(host, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+	tilt := make(chan monome.TiltEvent, 1)
+	g.SetTiltEvents(tilt)
+
+	// The key event is discarded and the tilt event after it still arrives.
+	go device.Write([]byte{0x21, 3, 4, 0x81, 0, 0, 1, 0, 2, 0, 3})
+	select {
+	case e := <-tilt:
+		if want := (monome.TiltEvent{N: 0, X: 1, Y: 2, Z: 3}); e != want {
+			t.Errorf("got %+v, want %+v", e, want)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for tilt event after a key event")
+	}
+}
+
+func TestDecode(t *testing.T) {
+	host, device := net.Pipe()
+	defer device.Close()
+	keys := make(chan monome.KeyEvent, 1)
+
+	go func() {
+		query := make([]byte, 3)
+		io.ReadFull(device, query)
+		id := make([]byte, 33)
+		id[0] = 0x01
+		copy(id[1:], "m1000001")
+		device.Write(id)
+		device.Write([]byte{0x03, 16, 8})
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	g, err := NewContext(ctx, host, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+	if g.Id() != "m1000001" || g.Width() != 16 || g.Height() != 8 {
+		t.Fatalf("got id %q, size %dx%d", g.Id(), g.Width(), g.Height())
+	}
+
+	tilt := make(chan monome.TiltEvent, 1)
+	deltas := make(chan monome.EncDeltaEvent, 1)
+	encKeys := make(chan monome.EncKeyEvent, 1)
+	g.SetTiltEvents(tilt)
+	g.SetEncEvents(deltas, encKeys)
+
+	go device.Write([]byte{
+		0xff,       // unknown, skipped
+		0x21, 3, 4, // key down
+		0x50, 1, 0xfe, // encoder delta
+		0x52, 2, // encoder key down
+		0x81, 0, 0x00, 0x01, 0xff, 0xff, 0x00, 0x03, // tilt
+	})
+	timeout := time.After(time.Second)
+	select {
+	case e := <-keys:
+		if want := (monome.KeyEvent{X: 3, Y: 4, State: 1, Time: e.Time, Seq: 1, Device: "m1000001"}); e != want {
+			t.Errorf("got %+v, want %+v", e, want)
+		}
+	case <-timeout:
+		t.Fatal("timed out waiting for key event")
+	}
+	select {
+	case e := <-deltas:
+		if want := (monome.EncDeltaEvent{N: 1, Delta: -2}); e != want {
+			t.Errorf("got %+v, want %+v", e, want)
+		}
+	case <-timeout:
+		t.Fatal("timed out waiting for encoder delta")
+	}
+	select {
+	case e := <-encKeys:
+		if want := (monome.EncKeyEvent{N: 2, State: 1}); e != want {
+			t.Errorf("got %+v, want %+v", e, want)
+		}
+	case <-timeout:
+		t.Fatal("timed out waiting for encoder key")
+	}
+	select {
+	case e := <-tilt:
+		if want := (monome.TiltEvent{N: 0, X: 1, Y: -1, Z: 3}); e != want {
+			t.Errorf("got %+v, want %+v", e, want)
+		}
+	case <-timeout:
+		t.Fatal("timed out waiting for tilt event")
+	}
+}
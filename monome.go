@@ -2,15 +2,16 @@
 package monome
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"math"
 	"net"
 	"strconv"
 	"sync"
 	"time"
 
 	"github.com/kisielk/go-osc/osc"
+	"github.com/kisielk/monome/internal/check"
 )
 
 var (
@@ -22,12 +23,33 @@ var (
 	ErrTimeout = errors.New("connection timed out")
 )
 
+// defaultSerialOscAddress is the address that serialosc listens on.
+const defaultSerialOscAddress = "localhost:12002"
+
 // Connect is a utility method that establishes a connection to the first monome device it finds.
 // The device sends key events to the given channel.
-// It returns ErrTimeout if it can't connec to a device.
+// It returns ErrTimeout if it can't connect to a device within ConnectTimeout.
 func Connect(prefix string, keyEvents chan KeyEvent) (*Grid, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), ConnectTimeout)
+	defer cancel()
+	g, err := ConnectContext(ctx, prefix, keyEvents)
+	if errors.Is(err, context.DeadlineExceeded) {
+		return nil, ErrTimeout
+	}
+	return g, err
+}
+
+// ConnectContext is like Connect but waits for a device for as long as ctx allows.
+// It returns once the device has replied with its id, size and rotation.
+// If the device is found but ctx is done before it replies, the error is an *InfoError.
+func ConnectContext(ctx context.Context, prefix string, keyEvents chan KeyEvent) (*Grid, error) {
+	return connectContext(ctx, defaultSerialOscAddress, prefix, keyEvents)
+}
+
+// connectContext is like ConnectContext but uses the serialosc instance at address.
+func connectContext(ctx context.Context, address, prefix string, keyEvents chan KeyEvent) (*Grid, error) {
 	deviceEvents := make(chan DeviceEvent)
-	so, err := DialSerialOsc("", deviceEvents)
+	so, err := DialSerialOsc(address, deviceEvents)
 	if err != nil {
 		return nil, err
 	}
@@ -38,37 +60,42 @@ func Connect(prefix string, keyEvents chan KeyEvent) (*Grid, error) {
 	}
 	select {
 	case ev := <-deviceEvents:
-		g, err := DialGrid(":"+strconv.Itoa(int(ev.Port)), prefix, keyEvents)
-		if err != nil {
-			return nil, err
-		}
-		// Wait for the Id to become populated.
-		for i := 0; i < 100; i++ {
-			id := g.Id()
-			if id != "" {
-				return g, nil
-			}
-			time.Sleep(10 * time.Millisecond)
-		}
-		return nil, ErrTimeout
-	case <-time.After(ConnectTimeout):
-		return nil, ErrTimeout
+		return DialGridContext(ctx, ":"+strconv.Itoa(int(ev.Port)), prefix, keyEvents)
+	case <-ctx.Done():
+		return nil, fmt.Errorf("no device found: %w", ctx.Err())
 	}
 }
 
 // oscConnection is a bi-directional OSC connection
 type oscConnection struct {
+	mu         sync.Mutex // protects c
 	c          *osc.Client
 	s          *osc.Server
 	serverConn net.PacketConn
+
+	hmu      sync.RWMutex // protects handlers
+	handlers map[string]osc.HandlerFunc
 }
 
 func newOscConnection(address string) (*oscConnection, error) {
+	client, err := newClient(address)
+	if err != nil {
+		return nil, err
+	}
 	c, err := net.ListenPacket("udp", "127.0.0.1:0")
 	if err != nil {
 		return nil, err
 	}
 	s := &osc.Server{}
+	return &oscConnection{
+		c:          client,
+		serverConn: c,
+		s:          s,
+		handlers:   make(map[string]osc.HandlerFunc),
+	}, nil
+}
+
+func newClient(address string) (*osc.Client, error) {
 	host, port, err := net.SplitHostPort(address)
 	if err != nil {
 		return nil, err
@@ -77,12 +104,74 @@ func newOscConnection(address string) (*oscConnection, error) {
 	if err != nil {
 		return nil, err
 	}
-	go s.Serve(c)
-	return &oscConnection{
-		c:          osc.NewClient(host, p),
-		serverConn: c,
-		s:          s,
-	}, nil
+	return osc.NewClient(host, p), nil
+}
+
+// setAddress changes the address that messages are sent to.
+func (c *oscConnection) setAddress(address string) error {
+	client, err := newClient(address)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.c = client
+	c.mu.Unlock()
+	return nil
+}
+
+// handle registers f to be called for messages sent to address,
+// replacing any handler already registered for it.
+func (c *oscConnection) handle(address string, f osc.HandlerFunc) {
+	c.hmu.Lock()
+	c.handlers[address] = f
+	c.hmu.Unlock()
+}
+
+// unhandle removes the handler for address.
+func (c *oscConnection) unhandle(address string) {
+	c.hmu.Lock()
+	delete(c.handlers, address)
+	c.hmu.Unlock()
+}
+
+// serve starts dispatching received messages to the handlers until the connection is closed.
+// Messages are handled one at a time in the order they were received.
+// The handlers that must see the first replies from a device should be registered before serve is called.
+func (c *oscConnection) serve() {
+	go func() {
+		for {
+			p, err := c.s.ReceivePacket(c.serverConn)
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			if err != nil {
+				// Skip malformed packets.
+				continue
+			}
+			c.dispatch(p)
+		}
+	}()
+}
+
+// dispatch calls the handler registered for the address of each message in p.
+// Bundles are dispatched right away, regardless of their time tag.
+func (c *oscConnection) dispatch(p osc.Packet) {
+	switch p := p.(type) {
+	case *osc.Message:
+		c.hmu.RLock()
+		f := c.handlers[p.Address]
+		c.hmu.RUnlock()
+		if f != nil {
+			f(p)
+		}
+	case *osc.Bundle:
+		for _, m := range p.Messages {
+			c.dispatch(m)
+		}
+		for _, b := range p.Bundles {
+			c.dispatch(b)
+		}
+	}
 }
 
 // HostPort returns the local OSC server host and port.
@@ -98,7 +187,10 @@ func (c *oscConnection) send(address string, args ...interface{}) error {
 }
 
 func (c *oscConnection) sendMsg(m *osc.Message) error {
-	return c.c.Send(m)
+	c.mu.Lock()
+	client := c.c
+	c.mu.Unlock()
+	return client.Send(m)
 }
 
 // Close terminates the OSC connection.
@@ -110,6 +202,7 @@ func (c *oscConnection) Close() error {
 type SerialOsc struct {
 	*oscConnection
 	events chan DeviceEvent
+	queue  *eventQueue
 }
 
 // A DeviceEvent is a Monome device connection or disconnection event.
@@ -118,21 +211,29 @@ type DeviceEvent struct {
 	Type    string
 	Port    int
 	Removed bool // True if the device is being disconnected, otherwise false.
+
+	// notification is true if the event was sent in response to Notify.
+	notification bool
 }
 
 // DialSerialOsc creates a connection to a serialosc instance at the given address.
-// If an empty address is given it defaults to localhost:12002
-// Device add and remove events are sent to the given channel.
+// If an empty address is given it defaults to localhost:12002.
+// Device add and remove events are sent to the given channel, from a queue
+// following the Block policy with DefaultQueueSize events.
 func DialSerialOsc(address string, events chan DeviceEvent) (*SerialOsc, error) {
 	if address == "" {
-		address = "localhost:12002"
+		address = defaultSerialOscAddress
 	}
 	conn, err := newOscConnection(address)
-	s := &SerialOsc{conn, events}
-	s.s.Handle("/serialosc/device", s.handleAdd)
-	s.s.Handle("/serialosc/add", s.handleAdd)
-	s.s.Handle("/serialosc/remove", s.handleRemove)
-	return s, err
+	if err != nil {
+		return nil, err
+	}
+	s := &SerialOsc{conn, events, newEventQueue()}
+	s.handle("/serialosc/device", s.handleDevice)
+	s.handle("/serialosc/add", s.handleAdd)
+	s.handle("/serialosc/remove", s.handleRemove)
+	s.serve()
+	return s, nil
 }
 
 // List requests a list of all monome devices serialosc is aware of.
@@ -142,12 +243,29 @@ func (s *SerialOsc) List() error {
 	return s.send("/serialosc/list", host, int32(port))
 }
 
+// Notify requests a single notification of the next device being connected or disconnected.
+// serialosc forgets the request once it has been answered, so Notify must be called again
+// after every notification to keep receiving them.
+func (s *SerialOsc) Notify() error {
+	host, port := s.HostPort()
+	return s.send("/serialosc/notify", host, int32(port))
+}
+
+func (s *SerialOsc) handleDevice(msg *osc.Message) {
+	event, ok := s.handleDeviceEvent(msg)
+	if !ok {
+		return
+	}
+	s.deliver(event)
+}
+
 func (s *SerialOsc) handleAdd(msg *osc.Message) {
 	event, ok := s.handleDeviceEvent(msg)
 	if !ok {
 		return
 	}
-	s.events <- event
+	event.notification = true
+	s.deliver(event)
 }
 
 func (s *SerialOsc) handleRemove(msg *osc.Message) {
@@ -156,7 +274,27 @@ func (s *SerialOsc) handleRemove(msg *osc.Message) {
 		return
 	}
 	event.Removed = true
-	s.events <- event
+	event.notification = true
+	s.deliver(event)
+}
+
+// deliver queues event to be sent to the DeviceEvent channel.
+func (s *SerialOsc) deliver(event DeviceEvent) {
+	if s.events == nil {
+		return
+	}
+	s.queue.push(event.Id, func(done <-chan struct{}) {
+		select {
+		case s.events <- event:
+		case <-done:
+		}
+	})
+}
+
+// Close terminates the connection to serialosc. Events that have not been read are discarded.
+func (s *SerialOsc) Close() error {
+	s.queue.close()
+	return s.oscConnection.Close()
 }
 
 func (s *SerialOsc) handleDeviceEvent(msg *osc.Message) (event DeviceEvent, ok bool) {
@@ -181,66 +319,87 @@ type KeyEvent struct {
 	X     int
 	Y     int
 	State int // 1 for down, 0 for up.
+
+	Time   time.Time // When the event was received, including a monotonic clock reading.
+	Seq    uint64    // The number of the event among the key events from the device, starting at 1.
+	Device string    // The id of the device.
+}
+
+// A TiltEvent is received from grids with tilt sensors once the sensor is enabled with TiltSet.
+type TiltEvent struct {
+	N int // The sensor number.
+	X int
+	Y int
+	Z int
 }
 
 // Grid represents a connection to a Monome device via SerialOsc.
 type Grid struct {
-	*oscConnection
-	mu       sync.RWMutex
-	id       string
-	width    int
-	height   int
-	prefix   string
-	rotation int
-	events   chan KeyEvent
+	*device
+	events chan KeyEvent
+	tilt   chan TiltEvent
+
+	// Event delivery, see HandleKey and SetOverflowPolicy.
+	keyHandler  func(e KeyEvent)
+	tiltHandler func(e TiltEvent)
+	keyQueue    *eventQueue
+	tiltQueue   *eventQueue
+	keySeq      uint64 // the sequence number of the last key event
+	keys        *KeyState
+	closed      bool // set by Close
+
+	// Reconnection state, see EnableReconnect.
+	watcher      *SerialOsc
+	done         chan struct{}
+	detached     bool
+	leds         *LEDBuffer // the last LED state, nil until the size is known
+	ledsRotation int        // the rotation that leds is laid out for
+	intensity    int        // the last intensity, -1 if it was never set
+	onReconnect  func(err error)
 }
 
 // DialGrid connects to a Monome device using the given address.
 // The address is obtained from SerialOsc running on the local machine.
 // prefix is the OSC address prefix to be used by the local OSC server.
 // If an empty prefix is given, it defaults to /gopher.
-// KeyEvents which are received will be sent in to the given events channel.
+// KeyEvents which are received will be sent in to the given events channel,
+// which may be nil if they are only handled with HandleKey.
 func DialGrid(address, prefix string, events chan KeyEvent) (*Grid, error) {
-	conn, err := newOscConnection(address)
+	d, err := newDevice(address, prefix)
 	if err != nil {
 		return nil, err
 	}
-	if prefix == "" {
-		prefix = "/gopher"
-	}
-	d := &Grid{
-		oscConnection: conn,
-		prefix:        prefix,
-		events:        events,
-	}
-	d.s.Handle(prefix+"/grid/key", d.handleKey)
-	d.s.Handle("/sys/port", d.handlePort)
-	d.s.Handle("/sys/id", d.handleId)
-	d.s.Handle("/sys/size", d.handleSize)
-	d.s.Handle("/sys/prefix", d.handlePrefix)
-	d.s.Handle("/sys/rotation", d.handleRotation)
-	host, port := d.HostPort()
-	err = d.send("/sys/host", host)
+	g := &Grid{
+		device:    d,
+		events:    events,
+		keyQueue:  newEventQueue(),
+		tiltQueue: newEventQueue(),
+		keys:      NewKeyState(),
+		intensity: -1,
+	}
+	g.handlePrefixed("/grid/key", g.handleKey)
+	g.handlePrefixed("/grid/tilt", g.handleTilt)
+	err = g.start()
 	if err != nil {
-		d.Close()
 		return nil, err
 	}
-	err = d.send("/sys/port", int32(port))
-	if err != nil {
-		d.Close()
-		return nil, err
-	}
-	err = d.send("/sys/prefix", prefix)
+	return g, nil
+}
+
+// DialGridContext is like DialGrid but waits until the device has replied with its id,
+// size and rotation. If ctx is done first, the connection is closed and the
+// returned *InfoError lists the replies that never arrived.
+func DialGridContext(ctx context.Context, address, prefix string, events chan KeyEvent) (*Grid, error) {
+	g, err := DialGrid(address, prefix, events)
 	if err != nil {
-		d.Close()
 		return nil, err
 	}
-	err = d.send("/sys/info")
+	err = g.wait(ctx, sysId|sysSize|sysRotation)
 	if err != nil {
-		d.Close()
+		g.Close()
 		return nil, err
 	}
-	return d, nil
+	return g, nil
 }
 
 // Height returns the height of the connected Monome device.
@@ -257,105 +416,69 @@ func (g *Grid) Width() int {
 	return g.width
 }
 
-// Id returns the id of the connected Monome device.
-func (g *Grid) Id() string {
-	g.mu.RLock()
-	defer g.mu.RUnlock()
-	return g.id
-}
-
-// Prefix returns the OSC prefinx being used in communication with the connected Monome device.
-func (g *Grid) Prefix() string {
-	g.mu.RLock()
-	defer g.mu.RUnlock()
-	return g.prefix
-}
-
-// Rotation returns the rotation of the connected Monome device.
-func (g *Grid) Rotation() int {
+// bounds returns the size of the grid for checking coordinates, which is unknown
+// until the grid has replied to /sys/size.
+func (g *Grid) bounds() check.Bounds {
 	g.mu.RLock()
 	defer g.mu.RUnlock()
-	return g.rotation
+	return check.Bounds{Width: g.width, Height: g.height, Unknown: g.width == 0 || g.height == 0}
 }
 
-func (g *Grid) handlePort(msg *osc.Message) {
-	return
-}
-
-func (g *Grid) handleId(msg *osc.Message) {
-	if msg.CountArguments() != 1 {
+func (g *Grid) handleKey(msg *osc.Message) {
+	if msg.CountArguments() != 3 {
 		return
 	}
-	id, ok := msg.Arguments[0].(string)
+	x, ok := msg.Arguments[0].(int32)
 	if !ok {
 		return
 	}
-	g.mu.Lock()
-	g.id = id
-	g.mu.Unlock()
-}
-
-func (g *Grid) handleSize(msg *osc.Message) {
-	if msg.CountArguments() != 2 {
-		return
-	}
-	width, ok := msg.Arguments[0].(int32)
+	y, ok := msg.Arguments[1].(int32)
 	if !ok {
 		return
 	}
-	height, ok := msg.Arguments[1].(int32)
+	state, ok := msg.Arguments[2].(int32)
 	if !ok {
 		return
 	}
+	now := time.Now()
 	g.mu.Lock()
-	g.width = int(width)
-	g.height = int(height)
+	g.keySeq++
+	e := KeyEvent{X: int(x), Y: int(y), State: int(state), Time: now, Seq: g.keySeq, Device: g.id}
 	g.mu.Unlock()
+	g.keys.Update(e)
+	g.deliverKey(e)
 }
 
-func (g *Grid) handlePrefix(msg *osc.Message) {
-	if msg.CountArguments() != 1 {
-		return
-	}
-	prefix, ok := msg.Arguments[0].(string)
-	if !ok {
-		return
-	}
+// SetTiltEvents sets the channel that TiltEvents are sent to.
+// Tilt data is discarded while the channel is nil, which is the default.
+func (g *Grid) SetTiltEvents(events chan TiltEvent) {
 	g.mu.Lock()
-	g.prefix = prefix
+	g.tilt = events
 	g.mu.Unlock()
 }
 
-func (g *Grid) handleRotation(msg *osc.Message) {
-	if msg.CountArguments() != 1 {
+func (g *Grid) handleTilt(msg *osc.Message) {
+	if msg.CountArguments() != 4 {
 		return
 	}
-	rotation, ok := msg.Arguments[0].(int32)
-	if !ok {
-		return
+	var v [4]int
+	for i := range v {
+		a, ok := msg.Arguments[i].(int32)
+		if !ok {
+			return
+		}
+		v[i] = int(a)
 	}
-	g.mu.Lock()
-	g.rotation = int(rotation)
-	g.mu.Unlock()
+	g.deliverTilt(TiltEvent{v[0], v[1], v[2], v[3]})
 }
 
-func (g *Grid) handleKey(msg *osc.Message) {
-	if msg.CountArguments() != 3 {
-		return
-	}
-	x, ok := msg.Arguments[0].(int32)
-	if !ok {
-		return
-	}
-	y, ok := msg.Arguments[1].(int32)
-	if !ok {
-		return
-	}
-	state, ok := msg.Arguments[2].(int32)
-	if !ok {
-		return
+// TiltSet enables or disables tilt sensor n.
+// State must be 1 for on or 0 for off.
+func (g *Grid) TiltSet(n, state int) error {
+	if err := check.State(state); err != nil {
+		return err
 	}
-	g.events <- KeyEvent{int(x), int(y), int(state)}
+	return g.send(g.Prefix()+"/tilt/set", int32(n), int32(state))
 }
 
 func statesInterfaces(states []byte) []interface{} {
@@ -377,12 +500,23 @@ func levelsInterfaces(levels []int) []interface{} {
 // LEDSet sets the LED at (x, y) to the given state.
 // State must be 1 for on or 0 for off.
 func (g *Grid) LEDSet(x, y, state int) error {
+	if err := g.bounds().Point(x, y); err != nil {
+		return err
+	}
+	if err := check.State(state); err != nil {
+		return err
+	}
+	g.record(func(b *LEDBuffer) { b.setLevel(x, y, state*15) })
 	return g.send(g.Prefix()+"/grid/led/set", int32(x), int32(y), int32(state))
 }
 
 // LEDAll sets all LEDs to the given state.
 // State must be 1 for on or 0 for off.
 func (g *Grid) LEDAll(state int) error {
+	if err := check.State(state); err != nil {
+		return err
+	}
+	g.record(func(b *LEDBuffer) { b.fill(state * 15) })
 	return g.send(g.Prefix()+"/grid/led/all", int32(state))
 }
 
@@ -391,6 +525,14 @@ func (g *Grid) LEDAll(state int) error {
 // each bit representing the state of an LED in that row.
 // xOffset and yOffset must be multiples of 8.
 func (g *Grid) LEDMap(xOffset, yOffset int, states [8]byte) error {
+	if err := g.bounds().Point(xOffset, yOffset); err != nil {
+		return err
+	}
+	g.record(func(b *LEDBuffer) {
+		for y, s := range states {
+			b.setRowBits(xOffset, yOffset+y, s)
+		}
+	})
 	m := osc.NewMessage(g.Prefix()+"/grid/led/map", int32(xOffset), int32(yOffset))
 	m.Append(statesInterfaces(states[:])...)
 	return g.sendMsg(m)
@@ -399,36 +541,72 @@ func (g *Grid) LEDMap(xOffset, yOffset int, states [8]byte) error {
 // LEDRow sets a 8x1 row based on an x offset, a y row and a bitmask. (0-255)
 // The states bitmask represents the on/off states of the items in the row
 func (g *Grid) LEDRow(xOffset, y int, states ...byte) error {
+	if err := g.bounds().Bits(xOffset, y, 1, 0, states); err != nil {
+		return err
+	}
+	g.record(func(b *LEDBuffer) { b.setRowBits(xOffset, y, states...) })
 	m := osc.NewMessage(g.Prefix()+"/grid/led/row", int32(xOffset), int32(y))
 	m.Append(statesInterfaces(states)...)
 	return g.sendMsg(m)
 }
 
-// LEDCol sets a 1x8 col based on a y offset, an x row and an 8 bit bitmask. (0-255)
+// LEDCol sets a 1x8 col based on a y offset, an x column and an 8 bit bitmask. (0-255)
 // The states bitmask represents the on/off states of the items in the column
 func (g *Grid) LEDCol(x, yOffset int, states ...byte) error {
-	m := osc.NewMessage(g.Prefix()+"/grid/led/row", int32(x), int32(yOffset))
+	if err := g.bounds().Bits(x, yOffset, 0, 1, states); err != nil {
+		return err
+	}
+	g.record(func(b *LEDBuffer) { b.setColBits(x, yOffset, states...) })
+	m := osc.NewMessage(g.Prefix()+"/grid/led/col", int32(x), int32(yOffset))
 	m.Append(statesInterfaces(states)...)
 	return g.sendMsg(m)
 }
 
-// LEDIntensity sets the intensity of the grid LEDs.
+// LEDIntensity sets the intensity of the grid LEDs, in the range [0, 15].
 func (g *Grid) LEDIntensity(i int) error {
+	if err := check.Levels(i); err != nil {
+		return err
+	}
+	g.mu.Lock()
+	g.intensity = i
+	g.mu.Unlock()
 	return g.send(g.Prefix()+"/grid/led/intensity", int32(i))
 }
 
 // LEDLevel sets the level of the LED at coordinates x, y. The value of level must be in the range [0, 15].
 func (g *Grid) LEDLevelSet(x, y, level int) error {
+	if err := g.bounds().Point(x, y); err != nil {
+		return err
+	}
+	if err := check.Levels(level); err != nil {
+		return err
+	}
+	g.record(func(b *LEDBuffer) { b.setLevel(x, y, level) })
 	return g.send(g.Prefix()+"/grid/led/level/set", int32(x), int32(y), int32(level))
 }
 
 // LEDLevelAll sets the level of all LEDs.
 func (g *Grid) LEDLevelAll(level int) error {
+	if err := check.Levels(level); err != nil {
+		return err
+	}
+	g.record(func(b *LEDBuffer) { b.fill(level) })
 	return g.send(g.Prefix()+"/grid/led/level/all", int32(level))
 }
 
 // LEDLevelMap is like LEDMap but with control over the level.
 func (g *Grid) LEDLevelMap(xOffset, yOffset int, levels [64]int) error {
+	if err := g.bounds().Point(xOffset, yOffset); err != nil {
+		return err
+	}
+	if err := check.Levels(levels[:]...); err != nil {
+		return err
+	}
+	g.record(func(b *LEDBuffer) {
+		for y := 0; y < 8; y++ {
+			b.setLevels(xOffset, yOffset+y, 1, 0, levels[y*8:y*8+8])
+		}
+	})
 	m := osc.NewMessage(g.Prefix()+"/grid/led/level/map", int32(xOffset), int32(yOffset))
 	m.Append(levelsInterfaces(levels[:])...)
 	return g.sendMsg(m)
@@ -436,6 +614,13 @@ func (g *Grid) LEDLevelMap(xOffset, yOffset int, levels [64]int) error {
 
 // LEDLevelRow is like LEDRow but with control over the level.
 func (g *Grid) LEDLevelRow(xOffset, y int, levels []int) error {
+	if err := g.bounds().Run(xOffset, y, 1, 0, len(levels)); err != nil {
+		return err
+	}
+	if err := check.Levels(levels...); err != nil {
+		return err
+	}
+	g.record(func(b *LEDBuffer) { b.setLevels(xOffset, y, 1, 0, levels) })
 	m := osc.NewMessage(g.Prefix()+"/grid/led/level/row", int32(xOffset), int32(y))
 	m.Append(levelsInterfaces(levels)...)
 	return g.sendMsg(m)
@@ -443,179 +628,44 @@ func (g *Grid) LEDLevelRow(xOffset, y int, levels []int) error {
 
 // LEDLevelRow is like LEDCol but with control over the level.
 func (g *Grid) LEDLevelCol(x, yOffset int, levels []int) error {
+	if err := g.bounds().Run(x, yOffset, 0, 1, len(levels)); err != nil {
+		return err
+	}
+	if err := check.Levels(levels...); err != nil {
+		return err
+	}
+	g.record(func(b *LEDBuffer) { b.setLevels(x, yOffset, 0, 1, levels) })
 	m := osc.NewMessage(g.Prefix()+"/grid/led/level/col", int32(x), int32(yOffset))
 	m.Append(levelsInterfaces(levels)...)
 	return g.sendMsg(m)
 }
 
-// LEDBuffer can be used to buffer LED changes to a grid.
-// It supports all the same LED operations as a Grid, but
-// doesn't send anything until buffer.Render() is called.
-type LEDBuffer struct {
-	Buf    []int
-	width  int
-	height int
-}
-
-// Creates a new LEDBuffer with exposed .Buf value for direct
-// manipulation. Requires width and height to calculate size.
-func NewLEDBuffer(width, height int) *LEDBuffer {
-	return &LEDBuffer{
-		Buf:    make([]int, width*height),
-		width:  width,
-		height: height,
-	}
-}
-
-// Returns the index of the LEDBuffer given x and y coordinates
-func (b *LEDBuffer) GetIndexFromXY(x, y int) int {
-	index := (y * b.width) + x
-	return index
+// LEDWriter is implemented by anything that accepts the on/off LED operations of a grid,
+// such as a Grid or an LEDBuffer. The methods of Grid and LEDBuffer return an error
+// wrapping ErrOutOfBounds or ErrInvalidLevel for bad arguments, without changing any LEDs.
+type LEDWriter interface {
+	LEDSet(x, y, state int) error
+	LEDAll(state int) error
+	LEDMap(xOffset, yOffset int, states [8]byte) error
+	LEDRow(xOffset, y int, states ...byte) error
+	LEDCol(x, yOffset int, states ...byte) error
 }
 
-// Returns the x and y coortinate values given an LEDBuffer index
-func (b *LEDBuffer) GetXYFromIndex(i int) []int {
-	x := int(i % b.width)
-	y := int(math.Floor(float64(i) / float64(b.width)))
-	return []int{x, y}
+// LevelWriter is implemented by anything that accepts the varibright LED operations of a grid,
+// such as a Grid or an LEDBuffer. Levels must be in the range [0, 15].
+type LevelWriter interface {
+	LEDLevelSet(x, y, level int) error
+	LEDLevelAll(level int) error
+	LEDLevelMap(xOffset, yOffset int, levels [64]int) error
+	LEDLevelRow(xOffset, y int, levels []int) error
+	LEDLevelCol(x, yOffset int, levels []int) error
 }
 
-// Sets a single led in an LEDBuffer, either on (1) or off (0)
-func (b *LEDBuffer) LEDSet(x, y, state int) error {
-	b.LEDLevelSet(x, y, state*15)
-	return nil
-}
-
-// Sets all leds in an LEDBuffer, either on (1) or off (0)
-func (b *LEDBuffer) LEDAll(state int) error {
-	b.LEDLevelAll(state * 15)
-	return nil
-}
-
-// Writes an 8x8 quadrant of grid values to an LEDBuffer
-// states accepts a bitmask for each row of the quadrant
-func (b *LEDBuffer) LEDMap(xOffset, yOffset int, states [8]byte) error {
-	for row, data := range states {
-		b.LEDRow(xOffset, yOffset+row, data)
-	}
-	return nil
-}
-
-// Writes a Row of values to an LEDBuffer, states is a bitmask of values
-func (b *LEDBuffer) LEDRow(xOffset, y int, states ...byte) error {
-	if len(states) > b.width-xOffset {
-		panic(fmt.Errorf("too many states: %d. width (%d) - xOffset (%d) = %d",
-			len(states), b.width, xOffset, b.width-xOffset))
-	}
-
-	for row, data := range states {
-		d := uint(data)
-		for x := 0; x < 8; x++ {
-			state := d & 1 << uint(x)
-			b.LEDSet(xOffset+x, y+row, int(state))
-		}
-	}
-	return nil
-}
-
-// Writes a column of values to an LEDBuffer, states is a bitmask of values
-func (b *LEDBuffer) LEDCol(x, yOffset int, states ...byte) error {
-	if len(states) > b.height-yOffset {
-		panic(fmt.Errorf("too many levels: %d. height (%d) - yOffset (%d) = %d",
-			len(states), b.height, yOffset, b.height-yOffset))
-	}
-
-	for col, data := range states {
-		d := uint(data)
-		for y := 0; y < 8; y++ {
-			state := d & 1 << uint(y)
-			b.LEDSet(x+col, yOffset+y, int(state))
-		}
-	}
-	return nil
-}
-
-// Writes a single led value at x,y with varibright level values 0-15 to an LEDBuffer
-func (b *LEDBuffer) LEDLevelSet(x, y, level int) error {
-	b.Buf[x+(y*b.width)] = level
-	return nil
-}
-
-// Writes a single varibright level values 0-15 to an LEDBuffer
-func (b *LEDBuffer) LEDLevelAll(level int) error {
-	for y := 0; y < b.height; y++ {
-		for x := 0; x < b.height; x++ {
-			b.Buf[x+(y*b.width)] = level
-		}
-	}
-	return nil
-}
-
-// Writes an 8x8 quadrant of varibright values to an LEDBuffer, values 0-15
-func (b *LEDBuffer) LEDLevelMap(xOffset, yOffset int, levels [64]int) error {
-	for y := 0; y < 8; y++ {
-		for x := 0; x < 8; x++ {
-			b.Buf[x+xOffset+(y+yOffset)*b.width] = levels[x+y*8]
-		}
-	}
-	return nil
-}
-
-// Similar to LEDLevelMap but can map LEDBuffer to arbitrary size of device,
-// sice should contain enough values for target grid takes varibright level values 0-15
-func (b *LEDBuffer) LEDLevelMapAll(levels []int) error {
-	for i := 0; i < b.width*b.height; i++ {
-		b.Buf[i] = levels[i]
-	}
-	return nil
-}
-
-// Writes a row of data to a LEDBuffer, uses varibright levels 0-15
-func (b *LEDBuffer) LEDLevelRow(xOffset, y int, levels []int) error {
-	if len(levels) > b.width-xOffset {
-		panic(fmt.Errorf("too many levels: %d. width (%d) - xOffset (%d) = %d",
-			len(levels), b.width, xOffset, b.width-xOffset))
-	}
-
-	for x, level := range levels {
-		b.Buf[xOffset+x+y*b.width] = level
-	}
-	return nil
-}
-
-// Writes a column of data to a LEDBuffer, uses varibright levels 0-15
-func (b *LEDBuffer) LEDLevelCol(x, yOffset int, levels []int) error {
-	if len(levels) > b.height-yOffset {
-		panic(fmt.Errorf("too many levels: %d. height (%d) - yOffset (%d) = %d",
-			len(levels), b.height, yOffset, b.height-yOffset))
-	}
-
-	for y, level := range levels {
-		b.Buf[x+(y+yOffset)*b.width] = level
-	}
-	return nil
-}
-
-// Renders a LEDBuffer using LEDLevelMap which only requires one osc message
-// per 8x8 quadrant.
-func (b *LEDBuffer) Render(g *Grid) error {
-	for yOff := 0; yOff < b.height; yOff += 8 {
-		for xOff := 0; xOff < b.width; xOff += 8 {
-			err := g.LEDLevelMap(xOff, yOff, b.levelMap(xOff, yOff))
-			if err != nil {
-				return err
-			}
-		}
-	}
-	return nil
-}
-
-func (b *LEDBuffer) levelMap(xOffset, yOffset int) [64]int {
-	var m [64]int
-	for y := 0; y < 8; y++ {
-		for x := 0; x < 8; x++ {
-			m[x+y*8] = b.Buf[x+xOffset+(y+yOffset)*b.width]
-		}
-	}
-	return m
-}
+var (
+	_ LEDWriter   = (*Grid)(nil)
+	_ LevelWriter = (*Grid)(nil)
+	_ LEDWriter   = (*LEDBuffer)(nil)
+	_ LevelWriter = (*LEDBuffer)(nil)
+	_ LEDWriter   = (*Rotated)(nil)
+	_ LevelWriter = (*Rotated)(nil)
+)
@@ -0,0 +1,81 @@
+package monometest
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Arc is a fake monome arc listening on a local UDP port, speaking the
+// serialosc device protocol. It answers the /sys/* messages, keeps track of
+// the LED state set by /ring/* messages and can send encoder turns and
+// pushes to the application it is connected to.
+type Arc struct {
+	*device
+
+	// Protected by device.mu.
+	rings [][64]int
+}
+
+// NewArc starts a fake arc with the given id and number of encoders on a random local port.
+func NewArc(id string, encoders int) (*Arc, error) {
+	d, err := newDevice(id, fmt.Sprintf("monome arc %d", encoders), 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	a := &Arc{
+		device: d,
+		rings:  make([][64]int, encoders),
+	}
+	d.handleApp = a.handleApp
+	go serve(d.conn, d.handle)
+	return a, nil
+}
+
+// Ring returns the LED levels of ring n, clockwise from the top.
+func (a *Arc) Ring(n int) [64]int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.rings[n]
+}
+
+// Delta sends a turn of encoder n by delta steps to the application,
+// positive for clockwise.
+func (a *Arc) Delta(n, delta int) error {
+	return a.sendApp("/enc/delta", int32(n), int32(delta))
+}
+
+// Key sends a push (state 1) or release (state 0) of encoder n to the application.
+func (a *Arc) Key(n, state int) error {
+	return a.sendApp("/enc/key", int32(n), int32(state))
+}
+
+// handleApp applies a /ring/* message with the prefix removed.
+// It must be called with a.mu held.
+func (a *Arc) handleApp(address string, args []int) bool {
+	if !strings.HasPrefix(address, "/ring/") || len(args) == 0 || args[0] < 0 || args[0] >= len(a.rings) {
+		return false
+	}
+	ring := &a.rings[args[0]]
+	args = args[1:]
+	switch command := strings.TrimPrefix(address, "/ring/"); {
+	case command == "set" && len(args) == 2:
+		ring[args[0]&63] = args[1]
+	case command == "all" && len(args) == 1:
+		for x := range ring {
+			ring[x] = args[0]
+		}
+	case command == "map" && len(args) == 64:
+		copy(ring[:], args)
+	case command == "range" && len(args) == 3:
+		// The range runs clockwise from x1 to x2, wrapping around.
+		for x := args[0] & 63; ; x = (x + 1) & 63 {
+			ring[x] = args[2]
+			if x == args[1]&63 {
+				break
+			}
+		}
+	default:
+		return false
+	}
+	return true
+}
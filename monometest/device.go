@@ -0,0 +1,270 @@
+package monometest
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kisielk/go-osc/osc"
+)
+
+// device is the part of a fake device shared by grids and arcs: it listens on
+// a local UDP port, answers the /sys/* messages and records the LED messages
+// received from the application.
+type device struct {
+	conn   net.PacketConn
+	id     string
+	typ    string
+	width  int
+	height int
+
+	// handleApp applies a device message with the prefix removed and reports
+	// whether it is an LED message. It is called with mu held.
+	handleApp func(address string, args []int) bool
+
+	mu       sync.Mutex
+	app      *osc.Client // nil until both /sys/host and /sys/port are received
+	host     string
+	port     int
+	prefix   string
+	rotation int
+	messages []*osc.Message
+	updated  chan struct{}   // closed and replaced for every LED message
+	withheld map[string]bool // the /sys/* replies left out of the answer to /sys/info
+}
+
+// newDevice listens on a random local port. The caller sets handleApp and then serves the connection.
+func newDevice(id, typ string, width, height int) (*device, error) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	return &device{
+		conn:     conn,
+		id:       id,
+		typ:      typ,
+		width:    width,
+		height:   height,
+		prefix:   "/monome",
+		updated:  make(chan struct{}),
+		withheld: make(map[string]bool),
+	}, nil
+}
+
+// Id returns the id of the device.
+func (d *device) Id() string {
+	return d.id
+}
+
+// Type returns the device type reported to serialosc clients, such as "monome 128".
+func (d *device) Type() string {
+	return d.typ
+}
+
+// Addr returns the address the device is listening on.
+func (d *device) Addr() string {
+	return d.conn.LocalAddr().String()
+}
+
+// Port returns the port the device is listening on.
+func (d *device) Port() int {
+	return port(d.conn)
+}
+
+// Close stops the fake device.
+func (d *device) Close() error {
+	return d.conn.Close()
+}
+
+// Prefix returns the OSC prefix most recently set by the application.
+func (d *device) Prefix() string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.prefix
+}
+
+// Rotation returns the rotation most recently set by the application.
+func (d *device) Rotation() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.rotation
+}
+
+// Withhold leaves the given /sys/* replies, such as /sys/size, out of the answer to /sys/info,
+// as if they were lost, so that applications can be tested against devices that don't reply in time.
+func (d *device) Withhold(addresses ...string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, address := range addresses {
+		d.withheld[address] = true
+	}
+}
+
+// Messages returns all the LED messages received so far, in order.
+func (d *device) Messages() []*osc.Message {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]*osc.Message(nil), d.messages...)
+}
+
+// WaitMessages waits until at least n LED messages have been received in total.
+func (d *device) WaitMessages(n int, timeout time.Duration) error {
+	deadline := time.After(timeout)
+	for {
+		d.mu.Lock()
+		received := len(d.messages)
+		updated := d.updated
+		d.mu.Unlock()
+		if received >= n {
+			return nil
+		}
+		select {
+		case <-updated:
+		case <-deadline:
+			return fmt.Errorf("received %d LED messages, want %d", received, n)
+		}
+	}
+}
+
+func (d *device) sendApp(address string, args ...interface{}) error {
+	d.mu.Lock()
+	app, prefix := d.app, d.prefix
+	d.mu.Unlock()
+	if app == nil {
+		return fmt.Errorf("device %s: no application connected", d.id)
+	}
+	return app.Send(osc.NewMessage(prefix+address, args...))
+}
+
+func (d *device) handle(msg *osc.Message) {
+	if strings.HasPrefix(msg.Address, "/sys/") {
+		d.handleSys(msg)
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	address := strings.TrimPrefix(msg.Address, d.prefix)
+	if address == msg.Address {
+		return
+	}
+	args, ok := intArgs(msg)
+	if !ok {
+		return
+	}
+	if !d.handleApp(address, args) {
+		return
+	}
+	d.messages = append(d.messages, msg)
+	close(d.updated)
+	d.updated = make(chan struct{})
+}
+
+func (d *device) handleSys(msg *osc.Message) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	switch msg.Address {
+	case "/sys/host":
+		if host, ok := stringArg(msg); ok {
+			d.host = host
+			d.connect()
+			d.reply("/sys/host", d.host)
+		}
+	case "/sys/port":
+		if port, ok := intArg(msg); ok {
+			d.port = port
+			d.connect()
+			d.reply("/sys/port", int32(d.port))
+		}
+	case "/sys/prefix":
+		if prefix, ok := stringArg(msg); ok {
+			d.prefix = prefix
+			d.reply("/sys/prefix", d.prefix)
+		}
+	case "/sys/rotation":
+		if rotation, ok := intArg(msg); ok {
+			d.rotation = rotation
+			d.reply("/sys/rotation", int32(d.rotation))
+		}
+	case "/sys/info":
+		to := d.app
+		switch msg.CountArguments() {
+		case 1:
+			if port, ok := intArg(msg); ok {
+				to = osc.NewClient("localhost", port)
+			}
+		case 2:
+			if c, ok := clientArgs(msg); ok {
+				to = c
+			}
+		}
+		if to == nil {
+			return
+		}
+		// Like serialosc, the size is reported as seen through the rotation.
+		width, height := d.width, d.height
+		if d.rotation == 90 || d.rotation == 270 {
+			width, height = height, width
+		}
+		for _, reply := range []*osc.Message{
+			osc.NewMessage("/sys/id", d.id),
+			osc.NewMessage("/sys/size", int32(width), int32(height)),
+			osc.NewMessage("/sys/host", d.host),
+			osc.NewMessage("/sys/port", int32(d.port)),
+			osc.NewMessage("/sys/prefix", d.prefix),
+			osc.NewMessage("/sys/rotation", int32(d.rotation)),
+		} {
+			if !d.withheld[reply.Address] {
+				to.Send(reply)
+			}
+		}
+	}
+}
+
+// connect updates the application address once both the host and port are known.
+// It must be called with d.mu held.
+func (d *device) connect() {
+	if d.host == "" || d.port == 0 {
+		return
+	}
+	d.app = osc.NewClient(d.host, d.port)
+}
+
+// reply sends a message to the application, if one is connected.
+// It must be called with d.mu held.
+func (d *device) reply(address string, args ...interface{}) {
+	if d.app == nil {
+		return
+	}
+	d.app.Send(osc.NewMessage(address, args...))
+}
+
+func stringArg(msg *osc.Message) (string, bool) {
+	if msg.CountArguments() != 1 {
+		return "", false
+	}
+	s, ok := msg.Arguments[0].(string)
+	return s, ok
+}
+
+func intArg(msg *osc.Message) (int, bool) {
+	args, ok := intArgs(msg)
+	if !ok || len(args) != 1 {
+		return 0, false
+	}
+	return args[0], true
+}
+
+// intArgs returns the arguments of msg if they are all int32.
+func intArgs(msg *osc.Message) ([]int, bool) {
+	args := make([]int, len(msg.Arguments))
+	for i, a := range msg.Arguments {
+		n, ok := a.(int32)
+		if !ok {
+			return nil, false
+		}
+		args[i] = int(n)
+	}
+	return args, true
+}
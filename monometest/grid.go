@@ -0,0 +1,171 @@
+package monometest
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Grid is a fake monome grid listening on a local UDP port, speaking the
+// serialosc device protocol. It answers the /sys/* messages, keeps track of
+// the LED state set by /grid/led/* messages and can send key presses and tilt
+// data to the application it is connected to.
+type Grid struct {
+	*device
+
+	// Protected by device.mu.
+	intensity int
+	levels    []int
+	tilt      map[int]bool
+}
+
+// NewGrid starts a fake grid with the given id and size on a random local port.
+func NewGrid(id string, width, height int) (*Grid, error) {
+	d, err := newDevice(id, fmt.Sprintf("monome %d", width*height), width, height)
+	if err != nil {
+		return nil, err
+	}
+	g := &Grid{
+		device:    d,
+		intensity: 15,
+		levels:    make([]int, width*height),
+		tilt:      make(map[int]bool),
+	}
+	d.handleApp = g.handleApp
+	go serve(d.conn, d.handle)
+	return g, nil
+}
+
+// Intensity returns the intensity most recently set by the application.
+func (g *Grid) Intensity() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.intensity
+}
+
+// TiltEnabled reports whether the application has enabled tilt sensor n.
+func (g *Grid) TiltEnabled(n int) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.tilt[n]
+}
+
+// Frame returns a copy of the LED levels, one per LED in rows from top to bottom,
+// in the same layout as monome.LEDBuffer.Buf. LEDs turned on with the
+// non-varibright messages have level 15.
+// The layout is that of the device, whatever rotation the application has set.
+func (g *Grid) Frame() []int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return append([]int(nil), g.levels...)
+}
+
+// Level returns the LED level at (x, y) on the device. As with serialosc,
+// coordinates from the application are turned back by the rotation it has set.
+func (g *Grid) Level(x, y int) int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.levels[x+y*g.width]
+}
+
+// Key sends a key press (state 1) or release (state 0) at (x, y) to the application,
+// in the coordinates of the application.
+func (g *Grid) Key(x, y, state int) error {
+	return g.sendApp("/grid/key", int32(x), int32(y), int32(state))
+}
+
+// Tilt sends data from tilt sensor n to the application.
+func (g *Grid) Tilt(n, x, y, z int) error {
+	return g.sendApp("/grid/tilt", int32(n), int32(x), int32(y), int32(z))
+}
+
+// handleApp applies a /grid/* message with the prefix removed.
+// It must be called with g.mu held.
+func (g *Grid) handleApp(address string, args []int) bool {
+	if address == "/tilt/set" {
+		if len(args) == 2 {
+			g.tilt[args[0]] = args[1] != 0
+		}
+		return false
+	}
+	if !strings.HasPrefix(address, "/grid/led/") {
+		return false
+	}
+	g.applyLED(strings.TrimPrefix(address, "/grid/led/"), args)
+	return true
+}
+
+// applyLED updates the LED state for a /grid/led/* message.
+// It must be called with g.mu held.
+func (g *Grid) applyLED(command string, args []int) {
+	switch {
+	case command == "set" && len(args) == 3:
+		g.set(args[0], args[1], args[2]*15)
+	case command == "all" && len(args) == 1:
+		g.fill(args[0] * 15)
+	case command == "map" && len(args) == 10:
+		for y, s := range args[2:] {
+			g.setBits(args[0], args[1]+y, 1, 0, []int{s})
+		}
+	case command == "row" && len(args) >= 3:
+		g.setBits(args[0], args[1], 1, 0, args[2:])
+	case command == "col" && len(args) >= 3:
+		g.setBits(args[0], args[1], 0, 1, args[2:])
+	case command == "intensity" && len(args) == 1:
+		g.intensity = args[0]
+	case command == "level/set" && len(args) == 3:
+		g.set(args[0], args[1], args[2])
+	case command == "level/all" && len(args) == 1:
+		g.fill(args[0])
+	case command == "level/map" && len(args) == 66:
+		for i, level := range args[2:] {
+			g.set(args[0]+i%8, args[1]+i/8, level)
+		}
+	case command == "level/row" && len(args) >= 3:
+		for i, level := range args[2:] {
+			g.set(args[0]+i, args[1], level)
+		}
+	case command == "level/col" && len(args) >= 3:
+		for i, level := range args[2:] {
+			g.set(args[0], args[1]+i, level)
+		}
+	}
+}
+
+func (g *Grid) set(x, y, level int) {
+	x, y = g.unrotate(x, y)
+	if x < 0 || y < 0 || x >= g.width || y >= g.height {
+		return
+	}
+	g.levels[x+y*g.width] = level
+}
+
+// unrotate converts coordinates from the application to those of the device.
+// It must be called with g.mu held.
+func (g *Grid) unrotate(x, y int) (int, int) {
+	switch g.rotation {
+	case 90:
+		return y, g.height - 1 - x
+	case 180:
+		return g.width - 1 - x, g.height - 1 - y
+	case 270:
+		return g.width - 1 - y, x
+	}
+	return x, y
+}
+
+func (g *Grid) fill(level int) {
+	for i := range g.levels {
+		g.levels[i] = level
+	}
+}
+
+// setBits sets the LEDs from the bitmasks in states starting at (x, y) and
+// advancing by (dx, dy) for every bit, least significant bit first.
+func (g *Grid) setBits(x, y, dx, dy int, states []int) {
+	for i, s := range states {
+		for bit := 0; bit < 8; bit++ {
+			n := i*8 + bit
+			g.set(x+n*dx, y+n*dy, (s>>uint(bit)&1)*15)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+// Package monometest provides local stand-ins for serialosc and monome
+// grids and arcs, so that code using package monome can be tested without any hardware.
+package monometest
+
+import (
+	"net"
+	"strconv"
+	"sync"
+
+	"github.com/kisielk/go-osc/osc"
+)
+
+// SerialOsc is a fake serialosc instance listening on a local UDP port.
+// It answers /serialosc/list with the grids added to it and sends
+// /serialosc/add and /serialosc/remove to the applications that requested
+// them with /serialosc/notify.
+//
+// Like serialosc, a notify request is answered by a single notification.
+// Unlike serialosc, notifications for changes made while no notify request
+// is outstanding are queued and sent in response to the next request,
+// so tests don't depend on the timing of notify requests.
+type SerialOsc struct {
+	conn net.PacketConn
+
+	mu      sync.Mutex
+	devices []Device
+	notify  []*osc.Client
+	pending []*osc.Message
+}
+
+// Device is a fake device that can be added to a SerialOsc, such as a *Grid or an *Arc.
+type Device interface {
+	Id() string
+	Type() string
+	Port() int
+}
+
+// NewSerialOsc starts a fake serialosc instance on a random local port.
+func NewSerialOsc() (*SerialOsc, error) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s := &SerialOsc{conn: conn}
+	go serve(conn, s.handle)
+	return s, nil
+}
+
+// Addr returns the address the fake serialosc instance is listening on.
+func (s *SerialOsc) Addr() string {
+	return s.conn.LocalAddr().String()
+}
+
+// Close stops the fake serialosc instance. It does not close the devices added to it.
+func (s *SerialOsc) Close() error {
+	return s.conn.Close()
+}
+
+// Add makes a device known to serialosc, as if it had been plugged in.
+func (s *SerialOsc) Add(g Device) error {
+	s.mu.Lock()
+	s.devices = append(s.devices, g)
+	s.mu.Unlock()
+	return s.notifyAll(osc.NewMessage("/serialosc/add", g.Id(), g.Type(), int32(g.Port())))
+}
+
+// Remove removes a device from serialosc, as if it had been unplugged.
+func (s *SerialOsc) Remove(g Device) error {
+	s.mu.Lock()
+	for i, d := range s.devices {
+		if d == g {
+			s.devices = append(s.devices[:i], s.devices[i+1:]...)
+			break
+		}
+	}
+	s.mu.Unlock()
+	return s.notifyAll(osc.NewMessage("/serialosc/remove", g.Id(), g.Type(), int32(g.Port())))
+}
+
+// notifyAll answers all the outstanding notify requests with msg,
+// or queues it if there are none.
+func (s *SerialOsc) notifyAll(msg *osc.Message) error {
+	s.mu.Lock()
+	notify := s.notify
+	s.notify = nil
+	if len(notify) == 0 {
+		s.pending = append(s.pending, msg)
+	}
+	s.mu.Unlock()
+	for _, c := range notify {
+		err := c.Send(msg)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SerialOsc) handle(msg *osc.Message) {
+	c, ok := clientArgs(msg)
+	if !ok {
+		return
+	}
+	switch msg.Address {
+	case "/serialosc/list":
+		s.mu.Lock()
+		devices := append([]Device(nil), s.devices...)
+		s.mu.Unlock()
+		for _, g := range devices {
+			c.Send(osc.NewMessage("/serialosc/device", g.Id(), g.Type(), int32(g.Port())))
+		}
+	case "/serialosc/notify":
+		s.mu.Lock()
+		if len(s.pending) == 0 {
+			s.notify = append(s.notify, c)
+			s.mu.Unlock()
+			return
+		}
+		msg := s.pending[0]
+		s.pending = s.pending[1:]
+		s.mu.Unlock()
+		c.Send(msg)
+	}
+}
+
+// clientArgs returns a client for the host and port arguments of msg.
+func clientArgs(msg *osc.Message) (*osc.Client, bool) {
+	if msg.CountArguments() != 2 {
+		return nil, false
+	}
+	host, ok := msg.Arguments[0].(string)
+	if !ok {
+		return nil, false
+	}
+	port, ok := msg.Arguments[1].(int32)
+	if !ok {
+		return nil, false
+	}
+	return osc.NewClient(host, int(port)), true
+}
+
+// serve calls handle for every message received on conn until it is closed.
+// Messages are handled in the order they are received.
+func serve(conn net.PacketConn, handle func(msg *osc.Message)) {
+	s := &osc.Server{}
+	for {
+		p, err := s.ReceivePacket(conn)
+		if _, ok := err.(net.Error); ok {
+			return
+		}
+		if err != nil {
+			// Ignore malformed packets.
+			continue
+		}
+		if msg, ok := p.(*osc.Message); ok {
+			handle(msg)
+		}
+	}
+}
+
+func port(conn net.PacketConn) int {
+	_, p, _ := net.SplitHostPort(conn.LocalAddr().String())
+	n, _ := strconv.Atoi(p)
+	return n
+}
@@ -0,0 +1,195 @@
+package monome
+
+import (
+	"net"
+	"strconv"
+
+	"github.com/kisielk/go-osc/osc"
+)
+
+// EnableReconnect keeps the grid usable across the device being unplugged and plugged back in.
+// The serialosc instance at the given address is watched for the device being reconnected,
+// and if an empty address is given it defaults to localhost:12002.
+//
+// While the device is disconnected LED changes are not sent but the resulting LED state is
+// remembered. Once serialosc reports the same device id again, the grid switches to the
+// new port, directs the device to the local OSC server and restores its rotation and
+// the LED state. Use HandleReconnect to find out whether that succeeded.
+// LEDs set before EnableReconnect is called are restored too. Only the LEDs set once
+// the size of the grid is known are remembered, as it always is for grids returned by
+// Connect and DialGridContext.
+func (g *Grid) EnableReconnect(address string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.watcher != nil {
+		return nil
+	}
+	events := make(chan DeviceEvent, 16)
+	so, err := DialSerialOsc(address, events)
+	if err != nil {
+		return err
+	}
+	err = so.Notify()
+	if err != nil {
+		so.Close()
+		return err
+	}
+	g.watcher = so
+	g.done = make(chan struct{})
+	host := so.c.IP()
+	go watchDevices(so, events, g.done, func(ev DeviceEvent) {
+		g.handleDeviceEvent(host, ev)
+	})
+	return nil
+}
+
+// HandleReconnect sets a function that is called after every attempt to switch to the
+// device once it is plugged back in, with nil if the grid was restored or the error that
+// stopped it. f is called from the goroutine watching serialosc, so it must not block.
+// A nil f removes the handler.
+func (g *Grid) HandleReconnect(f func(err error)) {
+	g.mu.Lock()
+	g.onReconnect = f
+	g.mu.Unlock()
+}
+
+// Close terminates the connection to the grid.
+func (g *Grid) Close() error {
+	g.mu.Lock()
+	g.closed = true
+	if g.watcher != nil {
+		close(g.done)
+		g.watcher.Close()
+		g.watcher = nil
+	}
+	g.mu.Unlock()
+	g.keyQueue.close()
+	g.tiltQueue.close()
+	g.keys.Reset()
+	return g.oscConnection.Close()
+}
+
+// isClosed reports whether Close has been called.
+func (g *Grid) isClosed() bool {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.closed
+}
+
+// send is like oscConnection.send but drops the message while the device is disconnected.
+func (g *Grid) send(address string, args ...interface{}) error {
+	return g.sendMsg(osc.NewMessage(address, args...))
+}
+
+// sendMsg is like oscConnection.sendMsg but drops the message while the device is disconnected.
+func (g *Grid) sendMsg(m *osc.Message) error {
+	g.mu.RLock()
+	detached := g.detached
+	g.mu.RUnlock()
+	if detached {
+		return nil
+	}
+	return g.oscConnection.sendMsg(m)
+}
+
+// record applies an LED change to the remembered LED state, once the size of the grid is known.
+// The state is kept whether or not reconnection is enabled, so that it can be restored
+// even if EnableReconnect is called after drawing.
+func (g *Grid) record(f func(b *LEDBuffer)) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.syncLEDs()
+	if g.leds != nil {
+		f(g.leds)
+	}
+}
+
+// syncLEDs lays the remembered LED state out for the current size and rotation of the grid.
+// A new rotation turns the state with it, once the grid has reported the size that goes
+// with it, as the LEDs on the device stay as they are. Any other change of size starts
+// over with all LEDs off. It must be called with g.mu held.
+func (g *Grid) syncLEDs() {
+	if g.width == 0 || g.height == 0 {
+		return
+	}
+	if g.leds == nil {
+		g.leds = NewLEDBuffer(g.width, g.height)
+		g.ledsRotation = g.rotation
+		return
+	}
+	if g.rotation != g.ledsRotation {
+		turned, err := g.leds.Rotate((g.rotation - g.ledsRotation + 360) % 360)
+		if err != nil || turned.width != g.width || turned.height != g.height {
+			return
+		}
+		g.leds = turned
+		g.ledsRotation = g.rotation
+		return
+	}
+	if g.leds.width != g.width || g.leds.height != g.height {
+		g.leds = NewLEDBuffer(g.width, g.height)
+	}
+}
+
+// handleDeviceEvent tracks the device being disconnected and reconnected
+// to the serialosc instance at host.
+func (g *Grid) handleDeviceEvent(host string, ev DeviceEvent) {
+	if ev.Id != g.Id() {
+		return
+	}
+	if ev.Removed {
+		g.mu.Lock()
+		g.detached = true
+		g.mu.Unlock()
+		g.keys.Reset()
+		return
+	}
+	err := g.rebind(net.JoinHostPort(host, strconv.Itoa(ev.Port)))
+	g.mu.RLock()
+	f := g.onReconnect
+	g.mu.RUnlock()
+	if f != nil {
+		f(err)
+	}
+}
+
+// rebind switches the grid to a device at a new address and restores its rotation and LED state.
+func (g *Grid) rebind(address string) error {
+	err := g.setAddress(address)
+	if err != nil {
+		return err
+	}
+	// The LEDs are laid out for the rotation the grid had, which the new device may not
+	// have. It is set before the device information is requested, so that the size in
+	// the reply goes with it.
+	if rotation := g.Rotation(); rotation != 0 {
+		err = g.device.send("/sys/rotation", int32(rotation))
+		if err != nil {
+			return err
+		}
+	}
+	err = g.configure()
+	if err != nil {
+		return err
+	}
+	g.mu.Lock()
+	g.detached = false
+	g.syncLEDs()
+	var leds *LEDBuffer
+	if g.leds != nil {
+		leds = NewLEDBuffer(g.leds.width, g.leds.height)
+		copy(leds.Buf, g.leds.Buf)
+	}
+	intensity := g.intensity
+	g.mu.Unlock()
+	if intensity >= 0 {
+		err = g.LEDIntensity(intensity)
+		if err != nil {
+			return err
+		}
+	}
+	if leds == nil {
+		return nil
+	}
+	return leds.Render(g)
+}
@@ -0,0 +1,106 @@
+package monome
+
+import (
+	"sync"
+	"time"
+)
+
+// Renderer redraws an LEDBuffer to a grid at a limited frame rate.
+// Drawing is done with Draw, which is safe to call from many goroutines.
+// All the changes made between two frames are sent together in the next frame,
+// and nothing is sent for frames without changes.
+type Renderer struct {
+	w        LevelWriter
+	interval time.Duration
+
+	mu    sync.Mutex // protects buf and dirty
+	buf   *LEDBuffer // the pending frame
+	dirty bool
+	front *LEDBuffer // the last frame sent, only used by run
+
+	closeOnce sync.Once
+	done      chan struct{}
+	stopped   chan struct{}
+	err       error // the last render error, set by run
+}
+
+// DefaultFPS is the frame rate used by a Renderer created with an fps that isn't positive.
+const DefaultFPS = 60
+
+// NewRenderer creates a Renderer that draws a width by height buffer to w
+// at no more than fps frames per second. If fps is not positive, DefaultFPS is used.
+func NewRenderer(w LevelWriter, width, height int, fps float64) *Renderer {
+	if fps <= 0 {
+		fps = DefaultFPS
+	}
+	interval := time.Duration(float64(time.Second) / fps)
+	if interval < time.Nanosecond {
+		interval = time.Nanosecond
+	}
+	r := &Renderer{
+		w:        w,
+		interval: interval,
+		buf:      NewLEDBuffer(width, height),
+		front:    NewLEDBuffer(width, height),
+		done:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+	go r.run()
+	return r
+}
+
+// Draw calls f with the pending frame. The frame is locked while f runs,
+// so f must not retain b or call Draw itself.
+func (r *Renderer) Draw(f func(b *LEDBuffer)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	f(r.buf)
+	r.dirty = true
+}
+
+// Close stops rendering after sending any pending changes.
+// It returns the error from the last failed render, if any.
+func (r *Renderer) Close() error {
+	r.closeOnce.Do(func() {
+		close(r.done)
+	})
+	<-r.stopped
+	return r.err
+}
+
+func (r *Renderer) run() {
+	defer close(r.stopped)
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			r.render()
+		case <-r.done:
+			r.render()
+			return
+		}
+	}
+}
+
+// render sends the pending frame if it changed since the last frame.
+// The pending frame is copied so that drawing can continue while it is sent.
+func (r *Renderer) render() {
+	r.mu.Lock()
+	if !r.dirty {
+		r.mu.Unlock()
+		return
+	}
+	r.front.Swap(r.buf.Snapshot())
+	r.dirty = false
+	r.mu.Unlock()
+
+	err := r.front.Render(r.w)
+	if err != nil {
+		r.err = err
+		// Try again on the next frame.
+		r.mu.Lock()
+		r.dirty = true
+		r.mu.Unlock()
+	}
+}
@@ -0,0 +1,74 @@
+package monome
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// countingWriter counts the calls made to an LEDBuffer.
+type countingWriter struct {
+	*LEDBuffer
+	calls int
+}
+
+func (w *countingWriter) LEDLevelMap(xOffset, yOffset int, levels [64]int) error {
+	w.calls++
+	return w.LEDBuffer.LEDLevelMap(xOffset, yOffset, levels)
+}
+
+func TestRendererCoalesces(t *testing.T) {
+	w := &countingWriter{LEDBuffer: NewLEDBuffer(16, 8)}
+	// A low frame rate so that all drawing happens before the first frame.
+	r := NewRenderer(w, 16, 8, 1)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(x int) {
+			defer wg.Done()
+			for y := 0; y < 8; y++ {
+				r.Draw(func(b *LEDBuffer) {
+					b.LEDLevelSet(x, y, (x+y)%16)
+				})
+			}
+		}(i)
+	}
+	wg.Wait()
+	err := r.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := NewLEDBuffer(16, 8)
+	for i := range want.Buf {
+		want.Buf[i] = (i%16 + i/16) % 16
+	}
+	if !reflect.DeepEqual(w.Buf, want.Buf) {
+		t.Errorf("got %v, want %v", w.Buf, want.Buf)
+	}
+	if w.calls != 2 {
+		t.Errorf("got %d LEDLevelMap calls, want 2", w.calls)
+	}
+}
+
+func TestRendererDefaultFPS(t *testing.T) {
+	for _, fps := range []float64{0, -1, 1e12} {
+		w := NewLEDBuffer(8, 8)
+		r := NewRenderer(w, 8, 8, fps)
+		r.Draw(func(b *LEDBuffer) { b.LEDLevelSet(2, 3, 4) })
+		err := r.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if level := w.Buf[2+3*8]; level != 4 {
+			t.Errorf("fps %v: got level %d, want 4", fps, level)
+		}
+	}
+	r := NewRenderer(NewLEDBuffer(8, 8), 8, 8, 0)
+	defer r.Close()
+	if r.interval != time.Second/DefaultFPS {
+		t.Errorf("got interval %v, want %v", r.interval, time.Second/DefaultFPS)
+	}
+}
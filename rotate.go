@@ -0,0 +1,187 @@
+package monome
+
+import (
+	"fmt"
+	"sync"
+)
+
+// checkRotation checks that degrees is a multiple of 90 in [0, 270].
+func checkRotation(degrees int) error {
+	switch degrees {
+	case 0, 90, 180, 270:
+		return nil
+	}
+	return fmt.Errorf("invalid rotation %d, must be 0, 90, 180 or 270", degrees)
+}
+
+// rotatePoint returns the position of (x, y) in a width by height area after rotating the area
+// clockwise by degrees, along with the size of the rotated area.
+func rotatePoint(x, y, width, height, degrees int) (rx, ry, rwidth, rheight int) {
+	switch degrees {
+	case 90:
+		return height - 1 - y, x, height, width
+	case 180:
+		return width - 1 - x, height - 1 - y, width, height
+	case 270:
+		return y, width - 1 - x, height, width
+	}
+	return x, y, width, height
+}
+
+// Rotate returns a copy of the buffer rotated clockwise by 0, 90, 180 or 270 degrees.
+// Rotating by 90 or 270 degrees swaps the width and height.
+func (b *LEDBuffer) Rotate(degrees int) (*LEDBuffer, error) {
+	if err := checkRotation(degrees); err != nil {
+		return nil, err
+	}
+	levels := b.Snapshot()
+	_, _, width, height := rotatePoint(0, 0, b.width, b.height, degrees)
+	r := NewLEDBuffer(width, height)
+	for y := 0; y < b.height; y++ {
+		for x := 0; x < b.width; x++ {
+			rx, ry, _, _ := rotatePoint(x, y, b.width, b.height, degrees)
+			r.Buf[rx+ry*width] = levels[x+y*b.width]
+		}
+	}
+	return r, nil
+}
+
+// Rotated is a client-side view of a grid that is mounted turned clockwise by 90, 180
+// or 270 degrees, independent of the rotation done by serialosc. Its LED methods take
+// coordinates upright for someone looking at the mounted grid, and Key converts key events
+// from the grid to the same coordinates. For a 16x8 grid turned by 90 degrees, Rotated
+// is 8 wide and 16 high.
+//
+// Rotated keeps the state of the LEDs in an LEDBuffer. Every LED method updates it
+// and sends the LEDs that changed to the grid, turned to match the mounting.
+// When the size of the grid changes, such as after SetRotation and Refresh on a
+// grid that isn't square, Rotated follows it and starts over with all LEDs off.
+type Rotated struct {
+	g       *Grid
+	degrees int
+
+	mu       sync.Mutex // serializes updates to the grid
+	logical  *LEDBuffer // the LEDs as seen by the application
+	physical *LEDBuffer // the LEDs as laid out on the grid
+}
+
+// NewRotated returns a view of g for a grid mounted turned clockwise by degrees.
+// The size of g must be known, as it is for grids returned by Connect.
+func NewRotated(g *Grid, degrees int) (*Rotated, error) {
+	if err := checkRotation(degrees); err != nil {
+		return nil, err
+	}
+	_, _, width, height := rotatePoint(0, 0, g.Width(), g.Height(), degrees)
+	return &Rotated{
+		g:        g,
+		degrees:  degrees,
+		logical:  NewLEDBuffer(width, height),
+		physical: NewLEDBuffer(g.Width(), g.Height()),
+	}, nil
+}
+
+// Width returns the width of the grid as mounted.
+func (r *Rotated) Width() int {
+	_, _, width, _ := rotatePoint(0, 0, r.g.Width(), r.g.Height(), r.degrees)
+	return width
+}
+
+// Height returns the height of the grid as mounted.
+func (r *Rotated) Height() int {
+	_, _, _, height := rotatePoint(0, 0, r.g.Width(), r.g.Height(), r.degrees)
+	return height
+}
+
+// Key converts a key event from the grid to the coordinates of the mounted grid.
+func (r *Rotated) Key(e KeyEvent) KeyEvent {
+	e.X, e.Y, _, _ = rotatePoint(e.X, e.Y, r.g.Width(), r.g.Height(), r.degrees)
+	return e
+}
+
+// resize replaces the buffers with empty ones if the size of the grid has changed.
+// It must be called with r.mu held.
+func (r *Rotated) resize() {
+	width, height := r.g.Width(), r.g.Height()
+	if width == r.physical.Width() && height == r.physical.Height() {
+		return
+	}
+	_, _, lwidth, lheight := rotatePoint(0, 0, width, height, r.degrees)
+	r.logical = NewLEDBuffer(lwidth, lheight)
+	r.physical = NewLEDBuffer(width, height)
+}
+
+// update applies f to the logical LEDs and sends the resulting changes to the grid.
+func (r *Rotated) update(f func(b *LEDBuffer) error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.resize()
+	err := f(r.logical)
+	if err != nil {
+		return err
+	}
+	// The grid is turned clockwise, so the LEDs are turned back the other way.
+	turned, err := r.logical.Rotate((360 - r.degrees) % 360)
+	if err != nil {
+		return err
+	}
+	_, err = r.physical.Swap(turned.Buf)
+	if err != nil {
+		return err
+	}
+	return r.physical.Render(r.g)
+}
+
+// LEDSet is like Grid.LEDSet.
+func (r *Rotated) LEDSet(x, y, state int) error {
+	return r.update(func(b *LEDBuffer) error { return b.LEDSet(x, y, state) })
+}
+
+// LEDAll is like Grid.LEDAll.
+func (r *Rotated) LEDAll(state int) error {
+	return r.update(func(b *LEDBuffer) error { return b.LEDAll(state) })
+}
+
+// LEDMap is like Grid.LEDMap.
+func (r *Rotated) LEDMap(xOffset, yOffset int, states [8]byte) error {
+	return r.update(func(b *LEDBuffer) error { return b.LEDMap(xOffset, yOffset, states) })
+}
+
+// LEDRow is like Grid.LEDRow.
+func (r *Rotated) LEDRow(xOffset, y int, states ...byte) error {
+	return r.update(func(b *LEDBuffer) error { return b.LEDRow(xOffset, y, states...) })
+}
+
+// LEDCol is like Grid.LEDCol.
+func (r *Rotated) LEDCol(x, yOffset int, states ...byte) error {
+	return r.update(func(b *LEDBuffer) error { return b.LEDCol(x, yOffset, states...) })
+}
+
+// LEDIntensity is like Grid.LEDIntensity.
+func (r *Rotated) LEDIntensity(i int) error {
+	return r.g.LEDIntensity(i)
+}
+
+// LEDLevelSet is like Grid.LEDLevelSet.
+func (r *Rotated) LEDLevelSet(x, y, level int) error {
+	return r.update(func(b *LEDBuffer) error { return b.LEDLevelSet(x, y, level) })
+}
+
+// LEDLevelAll is like Grid.LEDLevelAll.
+func (r *Rotated) LEDLevelAll(level int) error {
+	return r.update(func(b *LEDBuffer) error { return b.LEDLevelAll(level) })
+}
+
+// LEDLevelMap is like Grid.LEDLevelMap.
+func (r *Rotated) LEDLevelMap(xOffset, yOffset int, levels [64]int) error {
+	return r.update(func(b *LEDBuffer) error { return b.LEDLevelMap(xOffset, yOffset, levels) })
+}
+
+// LEDLevelRow is like Grid.LEDLevelRow.
+func (r *Rotated) LEDLevelRow(xOffset, y int, levels []int) error {
+	return r.update(func(b *LEDBuffer) error { return b.LEDLevelRow(xOffset, y, levels) })
+}
+
+// LEDLevelCol is like Grid.LEDLevelCol.
+func (r *Rotated) LEDLevelCol(x, yOffset int, levels []int) error {
+	return r.update(func(b *LEDBuffer) error { return b.LEDLevelCol(x, yOffset, levels) })
+}
@@ -0,0 +1,37 @@
+package monome
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLEDBufferRotate(t *testing.T) {
+	b := NewLEDBuffer(3, 2)
+	b.Buf = []int{
+		1, 2, 3,
+		4, 5, 6,
+	}
+	tests := []struct {
+		degrees       int
+		width, height int
+		want          []int
+	}{
+		{0, 3, 2, []int{1, 2, 3, 4, 5, 6}},
+		{90, 2, 3, []int{4, 1, 5, 2, 6, 3}},
+		{180, 3, 2, []int{6, 5, 4, 3, 2, 1}},
+		{270, 2, 3, []int{3, 6, 2, 5, 1, 4}},
+	}
+	for _, test := range tests {
+		r, err := b.Rotate(test.degrees)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.Width() != test.width || r.Height() != test.height || !reflect.DeepEqual(r.Buf, test.want) {
+			t.Errorf("Rotate(%d) = %dx%d %v, want %dx%d %v", test.degrees,
+				r.Width(), r.Height(), r.Buf, test.width, test.height, test.want)
+		}
+	}
+	if _, err := b.Rotate(45); err == nil {
+		t.Error("Rotate(45) did not fail")
+	}
+}
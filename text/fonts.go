@@ -0,0 +1,135 @@
+package text
+
+// The built-in fonts have glyphs for the digits, upper case letters and common
+// punctuation. Lower case letters are drawn using the upper case glyphs.
+// Each row of a glyph is a bitmask with the leftmost LED in the most significant bit.
+
+// Font3x5 is a compact 3x5 font that fits two characters across an 8x8 grid.
+var Font3x5 = &Font{
+	Width:  3,
+	Height: 5,
+	glyphs: map[rune][]byte{
+		'0':  {0b111, 0b101, 0b101, 0b101, 0b111},
+		'1':  {0b010, 0b110, 0b010, 0b010, 0b111},
+		'2':  {0b111, 0b001, 0b111, 0b100, 0b111},
+		'3':  {0b111, 0b001, 0b011, 0b001, 0b111},
+		'4':  {0b101, 0b101, 0b111, 0b001, 0b001},
+		'5':  {0b111, 0b100, 0b111, 0b001, 0b111},
+		'6':  {0b111, 0b100, 0b111, 0b101, 0b111},
+		'7':  {0b111, 0b001, 0b010, 0b010, 0b010},
+		'8':  {0b111, 0b101, 0b111, 0b101, 0b111},
+		'9':  {0b111, 0b101, 0b111, 0b001, 0b111},
+		'A':  {0b010, 0b101, 0b111, 0b101, 0b101},
+		'B':  {0b110, 0b101, 0b110, 0b101, 0b110},
+		'C':  {0b011, 0b100, 0b100, 0b100, 0b011},
+		'D':  {0b110, 0b101, 0b101, 0b101, 0b110},
+		'E':  {0b111, 0b100, 0b110, 0b100, 0b111},
+		'F':  {0b111, 0b100, 0b110, 0b100, 0b100},
+		'G':  {0b011, 0b100, 0b101, 0b101, 0b011},
+		'H':  {0b101, 0b101, 0b111, 0b101, 0b101},
+		'I':  {0b111, 0b010, 0b010, 0b010, 0b111},
+		'J':  {0b001, 0b001, 0b001, 0b101, 0b010},
+		'K':  {0b101, 0b101, 0b110, 0b101, 0b101},
+		'L':  {0b100, 0b100, 0b100, 0b100, 0b111},
+		'M':  {0b101, 0b111, 0b111, 0b101, 0b101},
+		'N':  {0b110, 0b101, 0b101, 0b101, 0b101},
+		'O':  {0b010, 0b101, 0b101, 0b101, 0b010},
+		'P':  {0b110, 0b101, 0b110, 0b100, 0b100},
+		'Q':  {0b010, 0b101, 0b101, 0b110, 0b011},
+		'R':  {0b110, 0b101, 0b110, 0b101, 0b101},
+		'S':  {0b011, 0b100, 0b010, 0b001, 0b110},
+		'T':  {0b111, 0b010, 0b010, 0b010, 0b010},
+		'U':  {0b101, 0b101, 0b101, 0b101, 0b111},
+		'V':  {0b101, 0b101, 0b101, 0b101, 0b010},
+		'W':  {0b101, 0b101, 0b111, 0b111, 0b101},
+		'X':  {0b101, 0b101, 0b010, 0b101, 0b101},
+		'Y':  {0b101, 0b101, 0b010, 0b010, 0b010},
+		'Z':  {0b111, 0b001, 0b010, 0b100, 0b111},
+		' ':  {0b000, 0b000, 0b000, 0b000, 0b000},
+		'.':  {0b000, 0b000, 0b000, 0b000, 0b010},
+		',':  {0b000, 0b000, 0b000, 0b010, 0b100},
+		':':  {0b000, 0b010, 0b000, 0b010, 0b000},
+		';':  {0b000, 0b010, 0b000, 0b010, 0b100},
+		'!':  {0b010, 0b010, 0b010, 0b000, 0b010},
+		'?':  {0b110, 0b001, 0b010, 0b000, 0b010},
+		'-':  {0b000, 0b000, 0b111, 0b000, 0b000},
+		'+':  {0b000, 0b010, 0b111, 0b010, 0b000},
+		'=':  {0b000, 0b111, 0b000, 0b111, 0b000},
+		'/':  {0b001, 0b001, 0b010, 0b100, 0b100},
+		'\'': {0b010, 0b010, 0b000, 0b000, 0b000},
+		'"':  {0b101, 0b101, 0b000, 0b000, 0b000},
+		'(':  {0b001, 0b010, 0b010, 0b010, 0b001},
+		')':  {0b100, 0b010, 0b010, 0b010, 0b100},
+		'%':  {0b101, 0b001, 0b010, 0b100, 0b101},
+		'#':  {0b101, 0b111, 0b101, 0b111, 0b101},
+		'*':  {0b000, 0b101, 0b010, 0b101, 0b000},
+		'_':  {0b000, 0b000, 0b000, 0b000, 0b111},
+		'<':  {0b001, 0b010, 0b100, 0b010, 0b001},
+		'>':  {0b100, 0b010, 0b001, 0b010, 0b100},
+	},
+}
+
+// Font4x6 is a 4x6 font, easier to read than Font3x5 from a distance.
+var Font4x6 = &Font{
+	Width:  4,
+	Height: 6,
+	glyphs: map[rune][]byte{
+		'0':  {0b0110, 0b1001, 0b1011, 0b1101, 0b1001, 0b0110},
+		'1':  {0b0010, 0b0110, 0b0010, 0b0010, 0b0010, 0b0111},
+		'2':  {0b0110, 0b1001, 0b0001, 0b0010, 0b0100, 0b1111},
+		'3':  {0b1110, 0b0001, 0b0110, 0b0001, 0b0001, 0b1110},
+		'4':  {0b0010, 0b0110, 0b1010, 0b1111, 0b0010, 0b0010},
+		'5':  {0b1111, 0b1000, 0b1110, 0b0001, 0b0001, 0b1110},
+		'6':  {0b0110, 0b1000, 0b1110, 0b1001, 0b1001, 0b0110},
+		'7':  {0b1111, 0b0001, 0b0010, 0b0100, 0b0100, 0b0100},
+		'8':  {0b0110, 0b1001, 0b0110, 0b1001, 0b1001, 0b0110},
+		'9':  {0b0110, 0b1001, 0b1001, 0b0111, 0b0001, 0b0110},
+		'A':  {0b0110, 0b1001, 0b1001, 0b1111, 0b1001, 0b1001},
+		'B':  {0b1110, 0b1001, 0b1110, 0b1001, 0b1001, 0b1110},
+		'C':  {0b0110, 0b1001, 0b1000, 0b1000, 0b1001, 0b0110},
+		'D':  {0b1110, 0b1001, 0b1001, 0b1001, 0b1001, 0b1110},
+		'E':  {0b1111, 0b1000, 0b1110, 0b1000, 0b1000, 0b1111},
+		'F':  {0b1111, 0b1000, 0b1110, 0b1000, 0b1000, 0b1000},
+		'G':  {0b0111, 0b1000, 0b1011, 0b1001, 0b1001, 0b0111},
+		'H':  {0b1001, 0b1001, 0b1111, 0b1001, 0b1001, 0b1001},
+		'I':  {0b0111, 0b0010, 0b0010, 0b0010, 0b0010, 0b0111},
+		'J':  {0b0001, 0b0001, 0b0001, 0b0001, 0b1001, 0b0110},
+		'K':  {0b1001, 0b1010, 0b1100, 0b1100, 0b1010, 0b1001},
+		'L':  {0b1000, 0b1000, 0b1000, 0b1000, 0b1000, 0b1111},
+		'M':  {0b1001, 0b1111, 0b1111, 0b1001, 0b1001, 0b1001},
+		'N':  {0b1001, 0b1101, 0b1101, 0b1011, 0b1011, 0b1001},
+		'O':  {0b0110, 0b1001, 0b1001, 0b1001, 0b1001, 0b0110},
+		'P':  {0b1110, 0b1001, 0b1001, 0b1110, 0b1000, 0b1000},
+		'Q':  {0b0110, 0b1001, 0b1001, 0b1001, 0b1010, 0b0101},
+		'R':  {0b1110, 0b1001, 0b1001, 0b1110, 0b1010, 0b1001},
+		'S':  {0b0111, 0b1000, 0b0110, 0b0001, 0b0001, 0b1110},
+		'T':  {0b1110, 0b0100, 0b0100, 0b0100, 0b0100, 0b0100},
+		'U':  {0b1001, 0b1001, 0b1001, 0b1001, 0b1001, 0b0110},
+		'V':  {0b1001, 0b1001, 0b1001, 0b1001, 0b0110, 0b0110},
+		'W':  {0b1001, 0b1001, 0b1001, 0b1111, 0b1111, 0b1001},
+		'X':  {0b1001, 0b1001, 0b0110, 0b0110, 0b1001, 0b1001},
+		'Y':  {0b1010, 0b1010, 0b1010, 0b0100, 0b0100, 0b0100},
+		'Z':  {0b1111, 0b0001, 0b0010, 0b0100, 0b1000, 0b1111},
+		' ':  {0b0000, 0b0000, 0b0000, 0b0000, 0b0000, 0b0000},
+		'.':  {0b0000, 0b0000, 0b0000, 0b0000, 0b0000, 0b0100},
+		',':  {0b0000, 0b0000, 0b0000, 0b0000, 0b0100, 0b1000},
+		':':  {0b0000, 0b0100, 0b0000, 0b0000, 0b0100, 0b0000},
+		';':  {0b0000, 0b0100, 0b0000, 0b0000, 0b0100, 0b1000},
+		'!':  {0b0100, 0b0100, 0b0100, 0b0100, 0b0000, 0b0100},
+		'?':  {0b0110, 0b1001, 0b0010, 0b0100, 0b0000, 0b0100},
+		'-':  {0b0000, 0b0000, 0b1110, 0b0000, 0b0000, 0b0000},
+		'+':  {0b0000, 0b0100, 0b1110, 0b0100, 0b0000, 0b0000},
+		'=':  {0b0000, 0b1111, 0b0000, 0b1111, 0b0000, 0b0000},
+		'/':  {0b0001, 0b0001, 0b0010, 0b0100, 0b1000, 0b1000},
+		'\'': {0b0100, 0b0100, 0b0000, 0b0000, 0b0000, 0b0000},
+		'"':  {0b1010, 0b1010, 0b0000, 0b0000, 0b0000, 0b0000},
+		'(':  {0b0010, 0b0100, 0b0100, 0b0100, 0b0100, 0b0010},
+		')':  {0b0100, 0b0010, 0b0010, 0b0010, 0b0010, 0b0100},
+		'%':  {0b1001, 0b0001, 0b0010, 0b0100, 0b1000, 0b1001},
+		'#':  {0b0101, 0b1111, 0b0101, 0b1010, 0b1111, 0b1010},
+		'*':  {0b0000, 0b1001, 0b0110, 0b0110, 0b1001, 0b0000},
+		'_':  {0b0000, 0b0000, 0b0000, 0b0000, 0b0000, 0b1111},
+		'<':  {0b0001, 0b0010, 0b0100, 0b0100, 0b0010, 0b0001},
+		'>':  {0b1000, 0b0100, 0b0010, 0b0010, 0b0100, 0b1000},
+	},
+}
@@ -0,0 +1,136 @@
+// Package text draws text onto monome grids using small bitmap fonts.
+package text
+
+import (
+	"context"
+	"time"
+	"unicode"
+
+	"github.com/kisielk/monome"
+)
+
+// Font is a fixed width bitmap font.
+type Font struct {
+	Width  int // The width of each glyph, not including the column between glyphs.
+	Height int // The height of each glyph.
+	glyphs map[rune][]byte
+}
+
+// glyph returns the rows of the glyph for r. Lower case letters use the upper case
+// glyph and runes without a glyph are drawn as '?'.
+func (f *Font) glyph(r rune) []byte {
+	if g, ok := f.glyphs[r]; ok {
+		return g
+	}
+	if g, ok := f.glyphs[unicode.ToUpper(r)]; ok {
+		return g
+	}
+	return f.glyphs['?']
+}
+
+// TextWidth returns the number of columns taken by s, including the column between each glyph.
+func (f *Font) TextWidth(s string) int {
+	n := len([]rune(s))
+	if n == 0 {
+		return 0
+	}
+	return n*(f.Width+1) - 1
+}
+
+// Draw draws s at the given level with the top left corner of its first glyph at (x, y).
+// Only the LEDs that are part of a glyph are set, and text outside of b is clipped.
+// Like the drawing methods of monome.LEDBuffer, level is clamped to the range [0, 15].
+func Draw(b *monome.LEDBuffer, f *Font, x, y int, s string, level int) {
+	if level < 0 {
+		level = 0
+	} else if level > 15 {
+		level = 15
+	}
+	for _, r := range s {
+		for row, bits := range f.glyph(r) {
+			for col := 0; col < f.Width; col++ {
+				if bits>>uint(f.Width-1-col)&1 == 0 {
+					continue
+				}
+				px, py := x+col, y+row
+				if px < 0 || py < 0 || px >= b.Width() || py >= b.Height() {
+					continue
+				}
+				b.LEDLevelSet(px, py, level)
+			}
+		}
+		x += f.Width + 1
+	}
+}
+
+// Rasterize returns a buffer just large enough to hold s, drawn at the given level.
+func Rasterize(f *Font, s string, level int) *monome.LEDBuffer {
+	b := monome.NewLEDBuffer(f.TextWidth(s), f.Height)
+	Draw(b, f, 0, 0, s, level)
+	return b
+}
+
+// A Display is a grid that text can be scrolled across, such as a *monome.Grid or a *monome.Rotated.
+type Display interface {
+	monome.LevelWriter
+	Width() int
+	Height() int
+}
+
+// DefaultSpeed is the speed of a Marquee whose Speed is 0 or less, in columns per second.
+const DefaultSpeed = 10
+
+// Marquee scrolls text that doesn't fit on a grid across it from right to left.
+type Marquee struct {
+	Font  *Font   // The font to draw with, Font4x6 if nil.
+	Level int     // The level to draw the text at.
+	Speed float64 // The speed of the text in columns per second, DefaultSpeed if 0 or less.
+	Loop  bool    // Whether to start over once the text has scrolled off the grid.
+}
+
+// Run scrolls s across d, vertically centered, until it has scrolled off the left edge
+// or ctx is done. If m.Loop is set it only returns when ctx is done or rendering fails.
+//
+// Coordinates are those of d, so the text is upright on a Grid rotated by serialosc
+// and on a monome.Rotated view of a grid mounted turned.
+// The size of d is checked on every step, so the text follows rotations that swap
+// its width and height.
+func (m *Marquee) Run(ctx context.Context, d Display, s string) error {
+	f := m.Font
+	if f == nil {
+		f = Font4x6
+	}
+	speed := m.Speed
+	if speed <= 0 {
+		speed = DefaultSpeed
+	}
+	interval := time.Duration(float64(time.Second) / speed)
+	if interval <= 0 {
+		interval = 1
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var b *monome.LEDBuffer
+	for {
+		for x := d.Width(); x >= -f.TextWidth(s); x-- {
+			if b == nil || b.Width() != d.Width() || b.Height() != d.Height() {
+				b = monome.NewLEDBuffer(d.Width(), d.Height())
+			}
+			b.FillRect(0, 0, b.Width(), b.Height(), 0)
+			Draw(b, f, x, (b.Height()-f.Height)/2, s, m.Level)
+			err := b.Render(d)
+			if err != nil {
+				return err
+			}
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		if !m.Loop {
+			return nil
+		}
+	}
+}
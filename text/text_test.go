@@ -0,0 +1,120 @@
+package text
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/kisielk/monome"
+)
+
+func TestRasterize(t *testing.T) {
+	b := Rasterize(Font3x5, "1a", 9)
+	want := []int{
+		0, 9, 0, 0, 0, 9, 0,
+		9, 9, 0, 0, 9, 0, 9,
+		0, 9, 0, 0, 9, 9, 9,
+		0, 9, 0, 0, 9, 0, 9,
+		9, 9, 9, 0, 9, 0, 9,
+	}
+	if b.Width() != 7 || b.Height() != 5 || !reflect.DeepEqual(b.Buf, want) {
+		t.Errorf("got %dx%d %v, want 7x5 %v", b.Width(), b.Height(), b.Buf, want)
+	}
+}
+
+func TestDrawClips(t *testing.T) {
+	b := monome.NewLEDBuffer(4, 4)
+	Draw(b, Font4x6, -2, -2, "H", 15)
+	want := []int{
+		15, 15, 0, 0,
+		0, 15, 0, 0,
+		0, 15, 0, 0,
+		0, 15, 0, 0,
+	}
+	if !reflect.DeepEqual(b.Buf, want) {
+		t.Errorf("got %v, want %v", b.Buf, want)
+	}
+}
+
+func TestDrawClampsLevel(t *testing.T) {
+	b := monome.NewLEDBuffer(4, 6)
+	Draw(b, Font4x6, 0, 0, "I", 99)
+	lit := 0
+	for _, level := range b.Buf {
+		if level != 0 && level != 15 {
+			t.Fatalf("got level %d, want 0 or 15", level)
+		}
+		if level == 15 {
+			lit++
+		}
+	}
+	if lit == 0 {
+		t.Error("nothing was drawn")
+	}
+}
+
+// frames is a Display that records whether any LED was ever lit.
+type frames struct {
+	*monome.LEDBuffer
+	lit bool
+}
+
+func (f *frames) check(err error) error {
+	for _, level := range f.Snapshot() {
+		f.lit = f.lit || level > 0
+	}
+	return err
+}
+
+func (f *frames) LEDLevelSet(x, y, level int) error {
+	return f.check(f.LEDBuffer.LEDLevelSet(x, y, level))
+}
+
+func (f *frames) LEDLevelRow(x, y int, levels []int) error {
+	return f.check(f.LEDBuffer.LEDLevelRow(x, y, levels))
+}
+
+func (f *frames) LEDLevelCol(x, y int, levels []int) error {
+	return f.check(f.LEDBuffer.LEDLevelCol(x, y, levels))
+}
+
+func (f *frames) LEDLevelMap(x, y int, levels [64]int) error {
+	return f.check(f.LEDBuffer.LEDLevelMap(x, y, levels))
+}
+
+func TestMarquee(t *testing.T) {
+	d := &frames{LEDBuffer: monome.NewLEDBuffer(8, 8)}
+	m := &Marquee{Font: Font3x5, Level: 15, Speed: 1000}
+	err := m.Run(context.Background(), d, "HI")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !d.lit {
+		t.Error("no text was drawn")
+	}
+	for _, level := range d.Buf {
+		if level != 0 {
+			t.Fatalf("text still on the grid after scrolling: %v", d.Buf)
+		}
+	}
+
+	m.Loop = true
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err = m.Run(ctx, d, "HI")
+	if err != context.DeadlineExceeded {
+		t.Errorf("got error %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestMarqueeDefaultSpeed(t *testing.T) {
+	d := &frames{LEDBuffer: monome.NewLEDBuffer(8, 8)}
+	var m Marquee
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := m.Run(ctx, d, "HI")
+	if err != context.DeadlineExceeded {
+		t.Errorf("got error %v, want %v", err, context.DeadlineExceeded)
+	}
+}